@@ -1,8 +1,11 @@
 package api
 
 import (
+	"context"
+
 	"github.com/BOOMfinity/bfcord/discord"
 	"github.com/BOOMfinity/bfcord/internal/httpc"
+	"github.com/BOOMfinity/bfcord/metrics"
 	"github.com/BOOMfinity/golog/v2"
 	"github.com/andersfylling/snowflake/v5"
 	"github.com/valyala/fasthttp"
@@ -18,6 +21,8 @@ type Client interface {
 	GatewayInfo() (BotGateway, error)
 	GetCurrentUser() (discord.User, error)
 	Interaction(id snowflake.ID, token string) InteractionClient
+	// Drain waits until REST requests in flight are finished or ctx is done.
+	Drain(ctx context.Context) error
 }
 
 type client struct {
@@ -26,6 +31,10 @@ type client struct {
 	proxy CacheProxy
 }
 
+func (c *client) Drain(ctx context.Context) error {
+	return c.http.Drain(ctx)
+}
+
 func (c *client) Interaction(id snowflake.ID, token string) InteractionClient {
 	return InteractionResolver{
 		client: c,
@@ -118,6 +127,13 @@ func WithCacheProxy(proxy CacheProxy) ClientOption {
 	}
 }
 
+// WithMetrics reports REST requests (by route and status) and rate limits to reg.
+func WithMetrics(reg metrics.Registry) ClientOption {
+	return func(c *client) {
+		c.http.Metrics(reg)
+	}
+}
+
 func WithUserID(id snowflake.ID) ClientOption {
 	return func(c *client) {
 		c.user.ID = id
@@ -64,28 +64,56 @@ func NewDefault(cfg *DefaultConfig) Store {
 	}
 	def := new(Default)
 
-	def.users = NewMap[ID, User](cfg.Users)
-	def.guilds = NewMap[ID, Guild](cfg.Guilds)
-	def.channels = NewMap[ID, Channel](cfg.Channels)
-	def.messages = NewSubMap[ID, Map[ID, Message]](func() Map[ID, Message] {
+	def.users = newMap[ID, User](cfg.Disabled&StoreUsers != 0, cfg.Users)
+	def.guilds = newMap[ID, Guild](cfg.Disabled&StoreGuilds != 0, cfg.Guilds)
+	def.channels = newMap[ID, Channel](cfg.Disabled&StoreChannels != 0, cfg.Channels)
+	def.messages = newSubMap[ID, Map[ID, Message]](cfg.Disabled&StoreMessages != 0, func() Map[ID, Message] {
 		return NewLimitedMap[ID, Message](cfg.MessageLimit, cfg.Messages)
-	})
-	def.members = NewSubMap[ID, Map[ID, Member]](func() Map[ID, Member] {
+	}, NewNopMap[ID, Message])
+	def.members = newSubMap[ID, Map[ID, Member]](cfg.Disabled&StoreMembers != 0, func() Map[ID, Member] {
 		return NewMap[ID, Member](cfg.Members)
-	})
-	def.scheduledEvents = NewSubMap[ID, Map[ID, ScheduledEvent]](func() Map[ID, ScheduledEvent] {
+	}, NewNopMap[ID, Member])
+	def.scheduledEvents = newSubMap[ID, Map[ID, ScheduledEvent]](cfg.Disabled&StoreScheduledEvents != 0, func() Map[ID, ScheduledEvent] {
 		return NewMap[ID, ScheduledEvent](0)
-	})
-	def.presences = NewSubMap[ID, Map[ID, Presence]](func() Map[ID, Presence] {
+	}, NewNopMap[ID, ScheduledEvent])
+	def.presences = newSubMap[ID, Map[ID, Presence]](cfg.Disabled&StorePresences != 0, func() Map[ID, Presence] {
 		return NewMap[ID, Presence](cfg.Presences)
-	})
-	def.voice = NewSubMap[ID, Map[ID, VoiceState]](func() Map[ID, VoiceState] {
+	}, NewNopMap[ID, Presence])
+	def.voice = newSubMap[ID, Map[ID, VoiceState]](cfg.Disabled&StoreVoiceStates != 0, func() Map[ID, VoiceState] {
 		return NewMap[ID, VoiceState](0)
-	})
+	}, NewNopMap[ID, VoiceState])
 
 	return def
 }
 
+func newMap[K comparable, V any](disabled bool, preAllocation uint) Map[K, V] {
+	if disabled {
+		return NewNopMap[K, V]()
+	}
+	return NewMap[K, V](preAllocation)
+}
+
+func newSubMap[K comparable, V any](disabled bool, fn SubMapGen[V], nop SubMapGen[V]) SubMap[K, V] {
+	if disabled {
+		return NewNopSubMap[K, V](nop)
+	}
+	return NewSubMap[K, V](fn)
+}
+
+// Stores is a set of Default stores.
+type Stores uint
+
+const (
+	StoreUsers Stores = 1 << iota
+	StoreGuilds
+	StoreChannels
+	StoreMessages
+	StoreMembers
+	StorePresences
+	StoreScheduledEvents
+	StoreVoiceStates
+)
+
 // DefaultConfig is used to set up Default implementation of Store.
 type DefaultConfig struct {
 	Users           uint
@@ -96,4 +124,6 @@ type DefaultConfig struct {
 	Presences       uint
 	Members         uint
 	MessageLimit    int
+	// Disabled stores do not keep anything (see NewNopMap).
+	Disabled Stores
 }
@@ -0,0 +1,62 @@
+package cache
+
+// nopMap is a disabled store. It does not keep anything, so Get always returns ErrNotFound.
+type nopMap[K comparable, V any] struct{}
+
+func (nopMap[K, V]) Get(K) (obj V, err error) {
+	return obj, ErrNotFound
+}
+
+func (nopMap[K, V]) Set(K, V) error {
+	return nil
+}
+
+func (nopMap[K, V]) Delete(K) error {
+	return nil
+}
+
+func (nopMap[K, V]) Has(K) error {
+	return ErrNotFound
+}
+
+func (nopMap[K, V]) Size() (int, error) {
+	return 0, nil
+}
+
+func (nopMap[K, V]) Each(MapLambda[V]) error {
+	return nil
+}
+
+func (nopMap[K, V]) Search(MapLambda[V]) ([]V, error) {
+	return nil, nil
+}
+
+func (nopMap[K, V]) Clear() error {
+	return nil
+}
+
+func (nopMap[K, V]) Disabled() bool {
+	return true
+}
+
+// NewNopMap creates a disabled Map, which does not keep anything.
+func NewNopMap[K comparable, V any]() Map[K, V] {
+	return nopMap[K, V]{}
+}
+
+func (s *subMapImpl[K, V]) Disabled() bool {
+	return IsDisabled(s.Map)
+}
+
+// NewNopSubMap creates a disabled SubMap. Get returns maps created by fn, which should be disabled as well.
+func NewNopSubMap[K comparable, V any](fn SubMapGen[V]) SubMap[K, V] {
+	return &subMapImpl[K, V]{Map: nopMap[K, V]{}, gen: fn}
+}
+
+// IsDisabled reports whether the store (Map or SubMap) does not keep anything, like the ones created with NewNopMap.
+// Custom stores can be reported as disabled with Disabled() bool method. Events updating only disabled stores
+// are skipped by the automatic event filter of the session.
+func IsDisabled(store any) bool {
+	d, ok := store.(interface{ Disabled() bool })
+	return ok && d.Disabled()
+}
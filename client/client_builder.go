@@ -1,20 +1,35 @@
 package client
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"github.com/BOOMfinity/bfcord/api"
+	"io"
+	"maps"
+	"slices"
 	"time"
 
-	"github.com/BOOMfinity/go-utils/rate"
 	"github.com/BOOMfinity/golog/v2"
 	"github.com/andersfylling/snowflake/v5"
 
 	"github.com/BOOMfinity/bfcord/client/cache"
 	"github.com/BOOMfinity/bfcord/client/events"
+	"github.com/BOOMfinity/bfcord/cluster"
+	"github.com/BOOMfinity/bfcord/metrics"
 	"github.com/BOOMfinity/bfcord/utils"
+	"github.com/BOOMfinity/bfcord/voice"
 	"github.com/BOOMfinity/bfcord/ws"
 )
 
+// errorsBufferSize is the capacity of Session.Errors channel. Errors are dropped when nobody reads them.
+const errorsBufferSize = 16
+
+// GatewayInfoSource provides the gateway URL, recommended shard count and session start limit (see wstest.Server).
+type GatewayInfoSource interface {
+	GatewayInfo() (api.BotGateway, error)
+}
+
 type Creator interface {
 	Cache(c cache.Store) Creator
 	Logger(log golog.Logger) Creator
@@ -23,6 +38,48 @@ type Creator interface {
 	Shards(c uint16, s ...uint16) Creator
 	Concurrency(c int) Creator
 	Intents(i ws.GatewayIntent) Creator
+	Compression(c ws.Compression) Creator
+	Encoding(e ws.Encoding) Creator
+	Presence(p ws.PresenceUpdate) Creator
+	SessionStore(s ws.SessionStore) Creator
+	ReconnectPolicy(p ws.ReconnectPolicy) Creator
+	// GatewayInfo replaces GET /gateway/bot request. Current user is not fetched from API then, so Build works offline.
+	GatewayInfo(src GatewayInfoSource) Creator
+	Recorder(r ws.Recorder) Creator
+	// Replay builds the session from recordings (see ws.NewReplayGateway) instead of connecting to Discord.
+	// Every recording becomes a shard with the ID of its map key.
+	Replay(speed float64, recordings map[uint16]io.Reader) Creator
+	// Metrics reports gateway, dispatcher and REST metrics to reg. metrics.NewRegistry serves them in OpenMetrics format.
+	Metrics(reg metrics.Registry) Creator
+	// AllowEvents makes shards decode only given dispatches. It replaces the list set by DenyEvents.
+	AllowEvents(names ...string) Creator
+	// DenyEvents makes shards skip decoding of given dispatches. It replaces the list set by AllowEvents.
+	DenyEvents(names ...string) Creator
+	// AutoEventFilter skips decoding of dispatches without a dispatcher listener or an update of an enabled cache store
+	// (see cache.IsDisabled). Listeners are checked when the dispatch arrives, so they can be added at any time.
+	// Listeners registered directly on shards do not count, the events they need have to be allowed with AllowEvents,
+	// which are decoded in addition to the automatic ones. Events denied with DenyEvents are never decoded.
+	AutoEventFilter() Creator
+	// AutoReshard reshards the session (see Session.Reshard) to the recommended shard count, when Discord closes
+	// a shard with 4011 (sharding required) code.
+	AutoReshard() Creator
+	// Cluster makes the session run shards leased by the coordinator (see cluster.Dial) instead of the ones set
+	// with ShardCount or Shards. Shards are started and closed when the coordinator moves them between processes,
+	// and identifies are limited by the coordinator, so max_concurrency and the session start limit are shared
+	// by the whole cluster.
+	Cluster(c cluster.Coordinator) Creator
+	// WaitForSessionStarts makes shards wait for the reset of the session start limit when it is exhausted. By default,
+	// they fail to identify with ws.ErrSessionStartLimit. In a cluster, it is set on the coordinator instead
+	// (see cluster.WaitForSessionStartReset).
+	WaitForSessionStarts() Creator
+	// StartupProgress calls fn every time a shard started by Session.Start connects or fails to connect.
+	StartupProgress(fn func(p StartupProgress)) Creator
+	// ReadyTimeout sets how long shards wait for guilds from READY before they are considered fully ready anyway
+	// (see Session.WaitReady). Default is 1 minute.
+	ReadyTimeout(timeout time.Duration) Creator
+	// Executor sets how dispatch handlers are run. By default, every dispatch runs in a new goroutine
+	// (see NewGoroutineExecutor). NewOrderedExecutor keeps dispatches of every guild in order.
+	Executor(e Executor) Creator
 	Build(token string) (Session, error)
 }
 
@@ -34,6 +91,124 @@ type creatorImpl struct {
 	shards       []uint16
 	intents      ws.GatewayIntent
 	concurrency  int
+	compression  ws.Compression
+	encoding     ws.Encoding
+	presence     *ws.PresenceUpdate
+	sessionStore ws.SessionStore
+	reconnect    ws.ReconnectPolicy
+	gatewayInfo  GatewayInfoSource
+	recorder     ws.Recorder
+	replay       map[uint16]io.Reader
+	replaySpeed  float64
+	metrics      metrics.Registry
+	eventFilter  ws.EventFilter
+	allowList    bool
+	autoFilter   bool
+	autoReshard  bool
+	coordinator  cluster.Coordinator
+	waitStarts   bool
+	progress     func(p StartupProgress)
+	readyTimeout time.Duration
+	executor     Executor
+}
+
+type staticGatewayInfo api.BotGateway
+
+func (s staticGatewayInfo) GatewayInfo() (api.BotGateway, error) {
+	return api.BotGateway(s), nil
+}
+
+func (ctr *creatorImpl) AllowEvents(names ...string) Creator {
+	ctr.eventFilter = ws.AllowEvents(names...)
+	ctr.allowList = true
+	return ctr
+}
+
+func (ctr *creatorImpl) DenyEvents(names ...string) Creator {
+	ctr.eventFilter = ws.DenyEvents(names...)
+	ctr.allowList = false
+	return ctr
+}
+
+func (ctr *creatorImpl) AutoEventFilter() Creator {
+	ctr.autoFilter = true
+	return ctr
+}
+
+func (ctr *creatorImpl) AutoReshard() Creator {
+	ctr.autoReshard = true
+	return ctr
+}
+
+func (ctr *creatorImpl) Cluster(c cluster.Coordinator) Creator {
+	ctr.coordinator = c
+	return ctr
+}
+
+func (ctr *creatorImpl) WaitForSessionStarts() Creator {
+	ctr.waitStarts = true
+	return ctr
+}
+
+func (ctr *creatorImpl) StartupProgress(fn func(p StartupProgress)) Creator {
+	ctr.progress = fn
+	return ctr
+}
+
+func (ctr *creatorImpl) ReadyTimeout(timeout time.Duration) Creator {
+	ctr.readyTimeout = timeout
+	return ctr
+}
+
+func (ctr *creatorImpl) Executor(e Executor) Creator {
+	ctr.executor = e
+	return ctr
+}
+
+func (ctr *creatorImpl) Metrics(reg metrics.Registry) Creator {
+	ctr.metrics = reg
+	return ctr
+}
+
+func (ctr *creatorImpl) Recorder(r ws.Recorder) Creator {
+	ctr.recorder = r
+	return ctr
+}
+
+func (ctr *creatorImpl) Replay(speed float64, recordings map[uint16]io.Reader) Creator {
+	ctr.replay = recordings
+	ctr.replaySpeed = speed
+	return ctr
+}
+
+func (ctr *creatorImpl) GatewayInfo(src GatewayInfoSource) Creator {
+	ctr.gatewayInfo = src
+	return ctr
+}
+
+func (ctr *creatorImpl) ReconnectPolicy(p ws.ReconnectPolicy) Creator {
+	ctr.reconnect = p
+	return ctr
+}
+
+func (ctr *creatorImpl) SessionStore(s ws.SessionStore) Creator {
+	ctr.sessionStore = s
+	return ctr
+}
+
+func (ctr *creatorImpl) Presence(p ws.PresenceUpdate) Creator {
+	ctr.presence = &p
+	return ctr
+}
+
+func (ctr *creatorImpl) Encoding(e ws.Encoding) Creator {
+	ctr.encoding = e
+	return ctr
+}
+
+func (ctr *creatorImpl) Compression(c ws.Compression) Creator {
+	ctr.compression = c
+	return ctr
 }
 
 func (ctr *creatorImpl) Concurrency(c int) Creator {
@@ -80,15 +255,31 @@ func (ctr *creatorImpl) Build(token string) (Session, error) {
 	if token == "" {
 		return nil, fmt.Errorf("token required")
 	}
-	rest := api.NewClient(ctr.log.Module("api"), token, api.WithCacheProxy(proxyImpl{ctr.cache}))
+	rest := api.NewClient(ctr.log.Module("api"), token, api.WithCacheProxy(proxyImpl{ctr.cache}), api.WithMetrics(ctr.metrics))
 	sess := new(sessionImpl)
 	sess.handlers = utils.NewSimpleMap[string, handleDispatchFn]()
-	sess.unavailable = utils.NewSimpleMap[uint16, utils.SimpleMap[snowflake.ID, ws.UnavailableGuild]]()
-	sess.events = events.NewSessionDispatcher(ctr.log.Module("dispatcher"))
+	sess.voice = utils.NewSimpleMap[snowflake.ID, voice.Credentials]()
+	sess.errs = make(chan error, errorsBufferSize)
+	sess.events = events.NewSessionDispatcher(ctr.log.Module("dispatcher"), events.WithMetrics(ctr.metrics))
+	sess.metrics.duration = metrics.Or(ctr.metrics).Histogram("bfcord_handler_duration_seconds", "Time spent processing a dispatch, including cache updates and listeners.", metrics.DefaultBuckets, "event")
 	sess.log = ctr.log
 	sess.cache = ctr.cache
 	sess.Client = rest
-	{
+	sess.recorder = ctr.recorder
+	if ctr.replay != nil {
+		ctr.autoSharding = false
+		ctr.shards = slices.Sorted(maps.Keys(ctr.replay))
+		if len(ctr.shards) > 0 {
+			ctr.shardCount = max(ctr.shardCount, ctr.shards[len(ctr.shards)-1]+1)
+		}
+		ctr.gatewayInfo = staticGatewayInfo{
+			Shards: ctr.shardCount,
+			Limit:  api.SessionStartLimit{MaxConcurrency: 1},
+		}
+		ctr.log.Debug().Send("Replaying %d recording(s)", len(ctr.replay))
+	}
+	if ctr.gatewayInfo == nil {
+		ctr.gatewayInfo = rest
 		ctr.log.Debug().Send("Fetching current user")
 		user, err := rest.GetCurrentUser()
 		if err != nil {
@@ -97,10 +288,20 @@ func (ctr *creatorImpl) Build(token string) (Session, error) {
 		ctr.log.Debug().Send("Identified as %s (%d)", user.Username, user.ID)
 	}
 	ctr.log.Debug().Send("Fetching bot gateway info")
-	gateway, err := rest.GatewayInfo()
+	gateway, err := ctr.gatewayInfo.GatewayInfo()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch bot gateway: %w", err)
 	}
+	if ctr.coordinator != nil && ctr.replay == nil {
+		ctr.log.Debug().Send("Joining the cluster")
+		lease, err := ctr.coordinator.Join(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to join the cluster: %w", err)
+		}
+		ctr.autoSharding = false
+		ctr.shardCount = lease.ShardCount
+		ctr.shards = lease.Shards
+	}
 	if ctr.autoSharding {
 		ctr.log.Debug().Send("Using recommended shard count from bot gateway info (%d)", gateway.Shards)
 		ctr.shardCount = gateway.Shards
@@ -118,30 +319,69 @@ func (ctr *creatorImpl) Build(token string) (Session, error) {
 		ctr.log.Debug().Send("Concurrency limit: %d (used-defined)", ctr.concurrency)
 	}
 	ctr.log.Debug().Send("Intents: %d", ctr.intents)
+	if ctr.compression != ws.CompressionNone {
+		ctr.log.Debug().Send("Transport compression: %s", ctr.compression)
+	}
+	if ctr.encoding != nil {
+		ctr.log.Debug().Send("Payload encoding: %s", ctr.encoding.Name())
+	}
 
 	sess.shards = make([]Shard, len(ctr.shards))
 	sess.shardCount = ctr.shardCount
+	sess.gatewayInfo = ctr.gatewayInfo
+	sess.replay = ctr.replay != nil
+	sess.autoReshard = ctr.autoReshard
+	sess.progress = ctr.progress
+	sess.readyTimeout = cmp.Or(ctr.readyTimeout, defaultReadyTimeout)
+	sess.readyCh = make(chan struct{})
+	sess.executor = ctr.executor
+	if sess.executor == nil {
+		sess.executor = NewGoroutineExecutor()
+	}
+	if ctr.replay == nil {
+		sess.coordinator = ctr.coordinator
+	}
 
-	limiter := rate.NewLimiter(5250*time.Millisecond, ctr.concurrency)
+	filter := sess.eventFilter(ctr.eventFilter, ctr.allowList, ctr.autoFilter)
 
+	sess.shardConfig = ws.Config{
+		Intents:         ctr.intents,
+		URL:             gateway.URL,
+		Compression:     ctr.compression,
+		Encoding:        ctr.encoding,
+		Presence:        ctr.presence,
+		Token:           token,
+		SessionStore:    ctr.sessionStore,
+		ReconnectPolicy: ctr.reconnect,
+		Recorder:        ctr.recorder,
+		Metrics:         ctr.metrics,
+		EventFilter:     filter,
+	}
+	if sess.coordinator != nil {
+		sess.shardConfig.IdentifyLimiter = ws.IdentifyLimiterFunc(sess.coordinator.Identify)
+	} else {
+		opts := []ws.IdentifySchedulerOption{
+			ws.WithSessionStartLimit(gateway.Limit.Total, gateway.Limit.Remaining, time.Duration(gateway.Limit.ResetAfter)*time.Millisecond),
+		}
+		if ctr.waitStarts {
+			opts = append(opts, ws.WaitForSessionStartReset())
+		}
+		ctr.log.Debug().Send("Session starts: %d of %d left, reset in %s", gateway.Limit.Remaining, gateway.Limit.Total, time.Duration(gateway.Limit.ResetAfter)*time.Millisecond)
+		sess.identify = ws.NewIdentifyScheduler(ctr.log.Module("identify"), ctr.concurrency, opts...)
+		sess.shardConfig.IdentifyLimiter = sess.identify
+	}
 	for i, id := range ctr.shards {
-		shard := &shardImpl{
-			ping:        -1,
-			unavailable: utils.NewSimpleMap[snowflake.ID, ws.UnavailableGuild](),
-			Gateway: ws.NewGateway(ws.Config{
-				Logger:        ctr.log.Module("gateway"),
-				Intents:       ctr.intents,
-				ID:            id,
-				URL:           gateway.URL,
-				Compression:   false,
-				Token:         token,
-				ShardCount:    ctr.shardCount,
-				GlobalLimiter: limiter,
-			}),
+		var shard *shardImpl
+		if ctr.replay != nil {
+			cfg := sess.shardConfig
+			cfg.Logger = ctr.log.Module("gateway")
+			cfg.ID = id
+			cfg.ShardCount = ctr.shardCount
+			shard = newShard(ws.NewReplayGateway(cfg, ctr.replay[id], ctr.replaySpeed))
+		} else {
+			shard = sess.newShard(id, ctr.shardCount)
 		}
-
-		go shard.backgroundJob()
-
+		shard.dispatching.Store(true)
 		sess.shards[i] = shard
 	}
 
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/BOOMfinity/bfcord/cluster"
+)
+
+// followLeases applies leases received from the cluster coordinator until the connection to it is lost.
+func (s *sessionImpl) followLeases() {
+	log := s.log.Module("cluster")
+	for lease := range s.coordinator.Leases() {
+		if s.stopping.Load() {
+			return
+		}
+		log.Info().Param("shards", lease.Shards).Param("count", lease.ShardCount).Send("Applying new lease")
+		s.applyLease(lease)
+	}
+	if !s.stopping.Load() {
+		s.reportError(fmt.Errorf("lost connection to the cluster coordinator, running shards are kept"))
+	}
+}
+
+// applyLease closes shards removed from the lease, acknowledges it and then starts the new ones.
+func (s *sessionImpl) applyLease(lease cluster.Lease) {
+	s.mut.Lock()
+	var (
+		kept     = make([]Shard, 0, len(lease.Shards))
+		released []*shardImpl
+	)
+	for _, shard := range s.shards {
+		// All shards are restarted when the shard count changes
+		if lease.ShardCount == s.shardCount && lease.Has(shard.ID()) {
+			kept = append(kept, shard)
+			continue
+		}
+		shard.(*shardImpl).dispatching.Store(false)
+		released = append(released, shard.(*shardImpl))
+	}
+	s.shards = kept
+	s.shardCount = lease.ShardCount
+	s.mut.Unlock()
+
+	for _, shard := range released {
+		shard.stop()
+		s.closeShard(shard)
+	}
+	if err := s.coordinator.Ack(lease); err != nil {
+		s.reportError(fmt.Errorf("failed to acknowledge the lease: %w", err))
+	}
+
+	var acquired []*shardImpl
+	s.mut.Lock()
+	for _, id := range lease.Shards {
+		if slices.ContainsFunc(s.shards, func(shard Shard) bool { return shard.ID() == id }) {
+			continue
+		}
+		shard := s.newShard(id, lease.ShardCount)
+		shard.dispatching.Store(true)
+		s.shards = append(s.shards, shard)
+		acquired = append(acquired, shard)
+	}
+	slices.SortFunc(s.shards, func(a, b Shard) int {
+		return int(a.ID()) - int(b.ID())
+	})
+	s.mut.Unlock()
+
+	if len(acquired) > 0 {
+		s.notReady()
+	}
+	// Identifies are spread by the coordinator, so shards can be connected at once
+	var wg sync.WaitGroup
+	wg.Add(len(acquired))
+	for _, shard := range acquired {
+		s.listen(shard)
+		go func() {
+			defer wg.Done()
+			if err := shard.Connect(context.Background()); err != nil {
+				s.reportError(ShardError{Shard: shard.ID(), Err: fmt.Errorf("failed to start leased shard: %w", err)})
+			}
+		}()
+	}
+	wg.Wait()
+	s.checkReady()
+}
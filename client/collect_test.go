@@ -0,0 +1,70 @@
+package client
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+
+	"github.com/BOOMfinity/bfcord/client/events"
+	"github.com/BOOMfinity/bfcord/ws"
+	"github.com/BOOMfinity/bfcord/ws/wstest"
+)
+
+func TestCollectMessages(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	sess := startSession(t, srv, newCreator())
+
+	ch, err := events.Stream(testContext(t), sess.Events().MessageCreate(), func(*ws.MessageCreateEvent) bool {
+		return true
+	}, 2, 0)
+	if err != nil {
+		t.Fatalf("failed to start collector: %s", err)
+	}
+	messages := []map[string]any{
+		{"id": "1", "channel_id": "10", "content": "first", "embeds": []map[string]any{{"title": "a"}, {"title": "b"}}},
+		{"id": "2", "channel_id": "10", "content": "second", "embeds": []map[string]any{{"title": "c"}}},
+	}
+	for _, msg := range messages {
+		if err = srv.Dispatch(0, "MESSAGE_CREATE", msg); err != nil {
+			t.Fatalf("failed to dispatch message: %s", err)
+		}
+	}
+	var collected []*ws.MessageCreateEvent
+	for msg := range ch {
+		collected = append(collected, msg)
+	}
+	if len(collected) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(collected))
+	}
+	// Default executor handles dispatches concurrently
+	slices.SortFunc(collected, func(a, b *ws.MessageCreateEvent) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	// Dispatch one more, so the pooled payload is reused again
+	if err = srv.Dispatch(0, "MESSAGE_CREATE", map[string]any{"id": "3", "channel_id": "10", "content": "third", "embeds": []map[string]any{{"title": "d"}}}); err != nil {
+		t.Fatalf("failed to dispatch message: %s", err)
+	}
+	if _, err = events.WaitFor(testContext(t), sess.Events().MessageCreate(), func(msg *ws.MessageCreateEvent) bool {
+		return msg.Content == "third"
+	}); err != nil {
+		t.Fatalf("third message was not received: %s", err)
+	}
+	expected := []struct {
+		content string
+		embeds  []string
+	}{{"first", []string{"a", "b"}}, {"second", []string{"c"}}}
+	for i, msg := range collected {
+		if msg.Content != expected[i].content {
+			t.Errorf("message %d: expected content %q, got %q", i, expected[i].content, msg.Content)
+		}
+		if len(msg.Embeds) != len(expected[i].embeds) {
+			t.Fatalf("message %d: expected %d embeds, got %d", i, len(expected[i].embeds), len(msg.Embeds))
+		}
+		for j, embed := range msg.Embeds {
+			if embed.Title != expected[i].embeds[j] {
+				t.Errorf("message %d: expected embed %q, got %q", i, expected[i].embeds[j], embed.Title)
+			}
+		}
+	}
+}
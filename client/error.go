@@ -0,0 +1,9 @@
+package client
+
+import "errors"
+
+var (
+	ErrReshardInProgress   = errors.New("resharding is already in progress")
+	ErrReshardNotSupported = errors.New("resharding is not supported by this session")
+	ErrShutdown            = errors.New("session has already been shut down")
+)
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"github.com/BOOMfinity/bfcord/client/cache"
+	"github.com/BOOMfinity/bfcord/client/events"
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+// eventRequirement describes when the session needs the dispatch.
+type eventRequirement struct {
+	// stores are cache stores updated by the handler
+	stores []storeFn
+	// listeners returns the number of dispatcher listeners receiving the event
+	listeners func(d events.SessionDispatcher) int
+}
+
+// storeFn returns the store (Map or SubMap) of the cache.
+type storeFn func(c cache.Store) any
+
+var (
+	usersStore           storeFn = func(c cache.Store) any { return c.Users() }
+	guildsStore          storeFn = func(c cache.Store) any { return c.Guilds() }
+	channelsStore        storeFn = func(c cache.Store) any { return c.Channels() }
+	messagesStore        storeFn = func(c cache.Store) any { return c.Messages() }
+	membersStore         storeFn = func(c cache.Store) any { return c.Members() }
+	scheduledEventsStore storeFn = func(c cache.Store) any { return c.ScheduledEvents() }
+)
+
+// requiredEvents are always decoded. Session keeps its state (guilds, voice credentials) with them
+// and FetchMembers waits for member chunks.
+var requiredEvents = map[string]struct{}{
+	"READY":               {},
+	"GUILD_CREATE":        {},
+	"GUILD_DELETE":        {},
+	"GUILD_MEMBERS_CHUNK": {},
+	"VOICE_STATE_UPDATE":  {},
+	"VOICE_SERVER_UPDATE": {},
+}
+
+var eventRequirements = map[string]eventRequirement{
+	"GUILD_UPDATE": {stores: []storeFn{guildsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildUpdate().Count()
+	}},
+	"GUILD_BAN_ADD": {listeners: func(d events.SessionDispatcher) int {
+		return d.GuildBanAdd().Count()
+	}},
+	"GUILD_BAN_REMOVE": {listeners: func(d events.SessionDispatcher) int {
+		return d.GuildBanRemove().Count()
+	}},
+	"CHANNEL_CREATE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ChannelCreate().Count()
+	}},
+	"CHANNEL_UPDATE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ChannelUpdate().Count()
+	}},
+	"CHANNEL_DELETE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ChannelDelete().Count()
+	}},
+	"CHANNEL_PINS_UPDATE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ChannelPinsUpdate().Count()
+	}},
+	"MESSAGE_CREATE": {stores: []storeFn{messagesStore, channelsStore, membersStore, usersStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.MessageCreate().Count()
+	}},
+	"MESSAGE_UPDATE": {stores: []storeFn{messagesStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.MessageUpdate().Count()
+	}},
+	"MESSAGE_DELETE": {stores: []storeFn{messagesStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.MessageDelete().Count()
+	}},
+	"THREAD_CREATE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ThreadCreate().Count()
+	}},
+	"THREAD_UPDATE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ThreadUpdate().Count()
+	}},
+	"THREAD_DELETE": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ThreadDelete().Count()
+	}},
+	"THREAD_LIST_SYNC": {stores: []storeFn{channelsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.ThreadListSync().Count()
+	}},
+	"THREAD_MEMBERS_UPDATE": {listeners: func(d events.SessionDispatcher) int {
+		return d.ThreadMembersUpdate().Count()
+	}},
+	"GUILD_ROLE_ADD": {stores: []storeFn{guildsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildRoleAdd().Count()
+	}},
+	"GUILD_ROLE_UPDATE": {stores: []storeFn{guildsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildRoleUpdate().Count()
+	}},
+	"GUILD_ROLE_DELETE": {stores: []storeFn{guildsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildRoleDelete().Count()
+	}},
+	"GUILD_SCHEDULED_EVENT_CREATE": {stores: []storeFn{scheduledEventsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildScheduledCreate().Count()
+	}},
+	"GUILD_SCHEDULED_EVENT_UPDATE": {stores: []storeFn{scheduledEventsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildScheduledUpdate().Count()
+	}},
+	"GUILD_SCHEDULED_EVENT_DELETE": {stores: []storeFn{scheduledEventsStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildScheduledDelete().Count()
+	}},
+	"GUILD_SCHEDULED_EVENT_USER_ADD": {listeners: func(d events.SessionDispatcher) int {
+		return d.GuildScheduledUserAdd().Count()
+	}},
+	"GUILD_SCHEDULED_EVENT_USER_REMOVE": {listeners: func(d events.SessionDispatcher) int {
+		return d.GuildScheduledUserRemove().Count()
+	}},
+	"GUILD_MEMBER_ADD": {stores: []storeFn{membersStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildMemberAdd().Count()
+	}},
+	"GUILD_MEMBER_UPDATE": {stores: []storeFn{membersStore, usersStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildMemberUpdate().Count()
+	}},
+	"GUILD_MEMBER_REMOVE": {stores: []storeFn{membersStore}, listeners: func(d events.SessionDispatcher) int {
+		return d.GuildMemberRemove().Count()
+	}},
+	"INVITE_CREATE": {listeners: func(d events.SessionDispatcher) int {
+		return d.InviteCreate().Count()
+	}},
+	"INVITE_DELETE": {listeners: func(d events.SessionDispatcher) int {
+		return d.InviteDelete().Count()
+	}},
+	"INTERACTION_CREATE": {listeners: func(d events.SessionDispatcher) int {
+		return d.InteractionCreate().Count()
+	}},
+}
+
+// wants reports whether the dispatch is used by the session: it updates the cache, has a listener
+// or the session depends on it. Events without a handler are never wanted.
+func (s *sessionImpl) wants(event string) bool {
+	if _, ok := requiredEvents[event]; ok {
+		return true
+	}
+	req, ok := eventRequirements[event]
+	if !ok {
+		return false
+	}
+	return s.cached(req.stores) || req.listeners(s.events) > 0
+}
+
+// cached reports whether any of the stores is enabled (see cache.IsDisabled).
+func (s *sessionImpl) cached(stores []storeFn) bool {
+	if s.cache == nil {
+		return false
+	}
+	for _, store := range stores {
+		if !cache.IsDisabled(store(s.cache)) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventFilter combines the user filter with the automatic one (if enabled). Events of the allow list are decoded
+// in addition to the wanted ones, while other filters (like the deny list) can only reject wanted events.
+func (s *sessionImpl) eventFilter(filter ws.EventFilter, allowList bool, auto bool) ws.EventFilter {
+	if !auto {
+		return filter
+	}
+	return ws.EventFilterFunc(func(event string) bool {
+		if filter == nil {
+			return s.wants(event)
+		}
+		if allowList {
+			return filter.Allow(event) || s.wants(event)
+		}
+		return filter.Allow(event) && s.wants(event)
+	})
+}
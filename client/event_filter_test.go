@@ -0,0 +1,101 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/bfcord/client/cache"
+	"github.com/BOOMfinity/bfcord/ws"
+	"github.com/BOOMfinity/bfcord/ws/wstest"
+)
+
+func TestEventFilter(t *testing.T) {
+	disabledMessages := cache.NewDefault(&cache.DefaultConfig{Disabled: cache.StoreMessages})
+	disabledAll := cache.NewDefault(&cache.DefaultConfig{Disabled: cache.StoreUsers | cache.StoreGuilds | cache.StoreChannels |
+		cache.StoreMessages | cache.StoreMembers | cache.StorePresences | cache.StoreScheduledEvents | cache.StoreVoiceStates})
+	tests := []struct {
+		name     string
+		creator  func(ctr Creator) Creator
+		listen   func(sess Session)
+		event    string
+		expected bool
+	}{
+		{name: "required event", event: "GUILD_CREATE", expected: true},
+		{name: "cached event", event: "MESSAGE_CREATE", expected: true},
+		{name: "event without handler", event: "TYPING_START", expected: false},
+		{name: "event without listener", event: "INVITE_CREATE", expected: false},
+		{name: "event with listener", event: "INVITE_CREATE", expected: true, listen: func(sess Session) {
+			sess.Events().InviteCreate().Listen(func(*ws.InviteCreateEvent) {})
+		}},
+		{name: "disabled store", event: "MESSAGE_UPDATE", expected: false, creator: func(ctr Creator) Creator {
+			return ctr.Cache(disabledMessages)
+		}},
+		{name: "one of stores enabled", event: "MESSAGE_CREATE", expected: true, creator: func(ctr Creator) Creator {
+			return ctr.Cache(disabledMessages)
+		}},
+		{name: "all stores disabled", event: "MESSAGE_CREATE", expected: false, creator: func(ctr Creator) Creator {
+			return ctr.Cache(disabledAll)
+		}},
+		{name: "without cache", event: "CHANNEL_CREATE", expected: false, creator: func(ctr Creator) Creator {
+			return ctr.Cache(nil)
+		}},
+		{name: "allow list adds events", event: "TYPING_START", expected: true, creator: func(ctr Creator) Creator {
+			return ctr.AllowEvents("TYPING_START")
+		}},
+		{name: "allow list keeps wanted events", event: "MESSAGE_CREATE", expected: true, creator: func(ctr Creator) Creator {
+			return ctr.AllowEvents("TYPING_START")
+		}},
+		{name: "deny list rejects wanted events", event: "MESSAGE_CREATE", expected: false, creator: func(ctr Creator) Creator {
+			return ctr.DenyEvents("MESSAGE_CREATE")
+		}},
+	}
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctr := newCreator().GatewayInfo(srv).AutoEventFilter()
+			if tt.creator != nil {
+				ctr = tt.creator(ctr)
+			}
+			sess, err := ctr.Build(testToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.listen != nil {
+				tt.listen(sess)
+			}
+			if got := sess.(*sessionImpl).shardConfig.EventFilter.Allow(tt.event); got != tt.expected {
+				t.Errorf("Allow(%s) = %v, expected %v", tt.event, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEventFilterShardListener(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	sess := startSession(t, srv, newCreator().AllowEvents("TYPING_START").AutoEventFilter())
+	listener, cancel := sess.Get(0).Listen(ws.WithEvents("PRESENCE_UPDATE", "TYPING_START"))
+	defer cancel()
+	if err := srv.Dispatch(0, "PRESENCE_UPDATE", map[string]any{"status": "online"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Dispatch(0, "TYPING_START", map[string]any{"channel_id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case msg := <-listener:
+			ev, ok := msg.(ws.InternalDispatchEvent)
+			if !ok || ev.OpCode != 0 {
+				continue
+			}
+			if ev.Event != "TYPING_START" {
+				t.Fatalf("received filtered %s event", ev.Event)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("TYPING_START was not received")
+		}
+	}
+}
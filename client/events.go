@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,43 +9,193 @@ import (
 	"github.com/BOOMfinity/golog/v2"
 	"github.com/segmentio/encoding/json"
 
+	"github.com/BOOMfinity/bfcord/client/events"
 	"github.com/BOOMfinity/bfcord/ws"
 )
 
-func (s *sessionImpl) handleEvents(shard Shard) {
-	pool := golog.NewPool(s.log.Module("event-handler"))
+// listen starts handling events of the shard in the background. Listener is registered before it returns,
+// so no event sent after that is missed.
+func (s *sessionImpl) listen(shard *shardImpl) {
 	listener, cancel := shard.Listen()
-	defer cancel()
-	for msg := range listener {
-		switch data := msg.(type) {
-		case ws.InternalDispatchEvent:
-			handler, _ := s.handlers.Get(data.Event)
-			if handler != nil {
-				go func() {
-					bench := golog.AcquireBenchmarkContext()
-					defer golog.ReleaseBenchmarkContext(bench)
-					log := pool.Get()
-					defer pool.Put(log)
-					log.Param("shard", shard.ID()).Param("event", data.Event)
-					defer log.Trace().Duration(bench.Elapsed())
-					bench.Update()
-					if err := handler(log, s, shard, data); err != nil {
-						log.Error().Throw(fmt.Errorf("failed to execute event handler: %w", err))
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Add(-1)
+		defer cancel()
+		s.handleEvents(shard, listener)
+	}()
+}
+
+func (s *sessionImpl) handleEvents(shard *shardImpl, listener <-chan any) {
+	pool := golog.NewPool(s.log.Module("event-handler"))
+	for {
+		select {
+		case msg, ok := <-listener:
+			if !ok {
+				return
+			}
+			s.handleEvent(pool, shard, msg)
+		case <-shard.done:
+			// Events received before the connection was closed are still handled
+			for {
+				select {
+				case msg, ok := <-listener:
+					if !ok {
 						return
 					}
-					log.Trace().Duration(bench.Elapsed()).Send("Event processed")
-					s.metrics.events.Add(1)
-					s.metrics.totalTime.Add(uint64(bench.Total().Nanoseconds()))
-				}()
+					s.handleEvent(pool, shard, msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *sessionImpl) handleEvent(pool golog.Pool, shard *shardImpl, msg any) {
+	switch data := msg.(type) {
+	case ws.InternalDispatchEvent:
+		// Readiness is tracked in order of dispatches, but reported after the cache is updated by the handler
+		complete := data.OpCode == 0 && s.trackReadiness(shard, data)
+		if h := s.handover.Load(); h != nil {
+			s.handOver(h, pool, shard, data, complete)
+			return
+		}
+		if !shard.dispatching.Load() {
+			data.Dereference()
+			if complete {
+				s.completeReadiness(shard)
 			}
+			return
+		}
+		s.execute(pool, shard, data, complete)
+	case ws.Status, ws.InternalConnectionClosed, ws.InternalResumedEvent, ws.InternalReconnectingEvent:
+		// Shards warming up during resharding are not a part of the session yet
+		if shard.dispatching.Load() {
+			s.dispatchShardEvent(shard, data)
+		}
+	case ws.InternalFatalErrorEvent:
+		s.reportError(ShardError{Shard: shard.ID(), Err: data.Err})
+		if s.autoReshard && errors.Is(data.Err, ws.ErrCloseShardingRequired) && shard.dispatching.Load() {
+			go s.reshardRequired()
 		}
 	}
 }
 
+// execute runs the handler of the dispatch with the executor of the session.
+func (s *sessionImpl) execute(pool golog.Pool, shard *shardImpl, data ws.InternalDispatchEvent, complete bool) {
+	handler, _ := s.handlers.Get(data.Event)
+	if handler == nil {
+		if complete {
+			s.completeReadiness(shard)
+		}
+		return
+	}
+	s.running.Add(1)
+	s.executor.Execute(data, func() {
+		defer s.running.Add(-1)
+		if complete {
+			defer s.completeReadiness(shard)
+		}
+		bench := golog.AcquireBenchmarkContext()
+		defer golog.ReleaseBenchmarkContext(bench)
+		log := pool.Get()
+		defer pool.Put(log)
+		log.Param("shard", shard.ID()).Param("event", data.Event)
+		defer log.Trace().Duration(bench.Elapsed())
+		bench.Update()
+		if err := handler(log, s, shard, data); err != nil {
+			log.Error().Throw(fmt.Errorf("failed to execute event handler: %w", err))
+			return
+		}
+		log.Trace().Duration(bench.Elapsed()).Send("Event processed")
+		s.metrics.events.Add(1)
+		s.metrics.totalTime.Add(uint64(bench.Total().Nanoseconds()))
+		s.metrics.duration.Observe(bench.Total().Seconds(), data.Event)
+	})
+}
+
+// dispatchShardEvent translates gateway events to shard lifecycle events. The state of the shard is tracked
+// by the event loop, while listeners are called by notify.
+func (s *sessionImpl) dispatchShardEvent(shard *shardImpl, ev any) {
+	id := shard.ID()
+	switch data := ev.(type) {
+	case ws.Status:
+		switch data {
+		case ws.StatusConnecting:
+			s.notify(shard, func() {
+				s.events.ShardConnecting().Send(id, func(handler events.ShardConnectingEvent) {
+					handler(id)
+				})
+			})
+		case ws.StatusResuming:
+			shard.resuming = true
+		case ws.StatusConnected:
+			// Resumed shards are reported by InternalResumedEvent
+			if !shard.resuming {
+				s.notify(shard, func() {
+					s.events.ShardReady().Send(id, func(handler events.ShardReadyEvent) {
+						handler(id)
+					})
+				})
+			}
+			shard.resuming = false
+		case ws.StatusDisconnected:
+			shard.resuming = false
+		}
+	case ws.InternalConnectionClosed:
+		s.notify(shard, func() {
+			s.events.ShardDisconnected().Send(id, func(handler events.ShardDisconnectedEvent) {
+				handler(id, data.Code, data.Err)
+			})
+		})
+	case ws.InternalResumedEvent:
+		s.notify(shard, func() {
+			s.events.ShardResumed().Send(id, func(handler events.ShardResumedEvent) {
+				handler(id, data.Replayed)
+			})
+		})
+	case ws.InternalReconnectingEvent:
+		s.notify(shard, func() {
+			s.events.ShardReconnecting().Send(id, func(handler events.ShardReconnectingEvent) {
+				handler(id, data.Attempt, data.Delay, data.Err)
+			})
+		})
+	}
+}
+
+// notify queues the lifecycle event of the shard. Events of one shard are sent in order by a single goroutine,
+// so slow listeners do not stop the event loop of the shard. Shutdown waits for them like for handlers.
+func (s *sessionImpl) notify(shard *shardImpl, fn func()) {
+	s.running.Add(1)
+	shard.lifecycleMut.Lock()
+	defer shard.lifecycleMut.Unlock()
+	shard.lifecycle = append(shard.lifecycle, fn)
+	if shard.notifying {
+		return
+	}
+	shard.notifying = true
+	go func() {
+		for {
+			shard.lifecycleMut.Lock()
+			if len(shard.lifecycle) == 0 {
+				shard.notifying = false
+				shard.lifecycleMut.Unlock()
+				return
+			}
+			fn := shard.lifecycle[0]
+			shard.lifecycle[0] = nil
+			shard.lifecycle = shard.lifecycle[1:]
+			shard.lifecycleMut.Unlock()
+			fn()
+			s.running.Add(-1)
+		}
+	}()
+}
+
 func (s *sessionImpl) metricsService() {
 	log := s.log.Module("metrics")
 
-	for {
+	for !s.stopping.Load() {
 		time.Sleep(30 * time.Second)
 		events := s.metrics.events.Swap(0)
 		totalTime := s.metrics.totalTime.Swap(0)
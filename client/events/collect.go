@@ -0,0 +1,216 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var ErrUnsupportedDispatcher = errors.New("dispatcher does not support collectors")
+
+// dataDispatcher is implemented by dispatchers created with NewDispatcher.
+type dataDispatcher interface {
+	listenData(declaredAt string, fn func(data any)) ListenerCancelFn
+}
+
+func (d *dispatcher[T]) listenData(declaredAt string, fn func(data any)) ListenerCancelFn {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	listener := d.createListener()
+	listener.DeclaredAt = declaredAt
+	listener.data = fn
+
+	return listener.cancel
+}
+
+// detach deep copies the payload. Handlers reuse payloads (and their slices) for next events once listeners return,
+// while collectors pass them further.
+func detach[D any](v D) D {
+	rv := reflect.ValueOf(&v).Elem()
+	rv.Set(deepCopy(rv))
+	return v
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		// Unexported fields (like in time.Time) are copied as they are
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := range v.NumField() {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+func callerOf(skip int) string {
+	_, file, number, _ := runtime.Caller(skip + 1)
+	return fmt.Sprintf("%s:%d", file, number)
+}
+
+// WaitFor waits for the first event matching the predicate. D is the payload of the event passed to Send, which is
+// the first argument of listeners for most events (like *ws.MessageCreateEvent for MessageCreate or *discord.Interaction
+// for InteractionCreate). Events with a different payload do not match. The listener is removed before it returns.
+// Returned payloads are deep copies, as handlers reuse the payloads for next events.
+//
+// With client.NewOrderedExecutor, listeners of one guild run one by one, so waiting from a listener for another event
+// of the same guild always ends with ctx error: the event is queued behind the waiting listener. Wait in a separate
+// goroutine then.
+//
+//	msg, err := events.WaitFor(ctx, sess.Events().MessageCreate(), func(msg *ws.MessageCreateEvent) bool {
+//		return msg.ChannelID == channel && msg.Author.ID == author
+//	})
+func WaitFor[D any, T SessionEvents](ctx context.Context, d Dispatcher[T], predicate func(data D) bool) (D, error) {
+	var zero D
+	dd, ok := d.(dataDispatcher)
+	if !ok {
+		return zero, ErrUnsupportedDispatcher
+	}
+	found := make(chan D, 1)
+	var once sync.Once
+	cancel := dd.listenData(callerOf(1), func(data any) {
+		v, ok := data.(D)
+		if !ok || !predicate(v) {
+			return
+		}
+		once.Do(func() {
+			found <- detach(v)
+		})
+	})
+	defer cancel()
+	select {
+	case v := <-found:
+		return v, nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Stream sends events matching the predicate (see WaitFor) to the returned channel, until ctx is done,
+// max events are sent or no event matches for idle duration. Limits lower than 1 are disabled. The channel
+// is closed and the listener is removed after that. Send waits for the channel to be read, so it has to be read
+// until it is closed.
+func Stream[D any, T SessionEvents](ctx context.Context, d Dispatcher[T], predicate func(data D) bool, max int, idle time.Duration) (<-chan D, error) {
+	return stream(ctx, d, callerOf(1), predicate, max, idle)
+}
+
+// Collect returns events matching the predicate (see Stream), after ctx is done, max events are collected or no event
+// matches for idle duration.
+//
+//	// Reactions collected for 5 minutes
+//	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+//	defer cancel()
+//	reactions, err := events.Collect(ctx, dispatcher, predicate, 0, 0)
+func Collect[D any, T SessionEvents](ctx context.Context, d Dispatcher[T], predicate func(data D) bool, max int, idle time.Duration) ([]D, error) {
+	ch, err := stream(ctx, d, callerOf(1), predicate, max, idle)
+	if err != nil {
+		return nil, err
+	}
+	var collected []D
+	for v := range ch {
+		collected = append(collected, v)
+	}
+	return collected, nil
+}
+
+func stream[D any, T SessionEvents](ctx context.Context, d Dispatcher[T], declaredAt string, predicate func(data D) bool, max int, idle time.Duration) (<-chan D, error) {
+	dd, ok := d.(dataDispatcher)
+	if !ok {
+		return nil, ErrUnsupportedDispatcher
+	}
+	var (
+		out     = make(chan D)
+		matched = make(chan D)
+		done    = make(chan struct{})
+	)
+	cancel := dd.listenData(declaredAt, func(data any) {
+		v, ok := data.(D)
+		if !ok || !predicate(v) {
+			return
+		}
+		select {
+		case matched <- detach(v):
+		case <-done:
+		}
+	})
+	go func() {
+		defer close(out)
+		defer close(done)
+		defer cancel()
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if idle > 0 {
+			timer = time.NewTimer(idle)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		for sent := 0; max < 1 || sent < max; sent++ {
+			select {
+			case v := <-matched:
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+				if timer != nil {
+					timer.Reset(idle)
+				}
+			case <-timeout:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -1,6 +1,8 @@
 package events
 
 import (
+	"time"
+
 	"github.com/BOOMfinity/bfcord/api"
 	"github.com/andersfylling/snowflake/v5"
 
@@ -13,6 +15,29 @@ import (
 
 type ReadyEvent func(shards []uint16, shardCount uint16, ready *ws.ReadyEvent)
 
+// Shard events are queued per shard and sent in order, outside of the event loop of the shard. Slow listeners
+// (like alerts sent over HTTP) delay only the next events of the shard.
+
+type ShardConnectingEvent func(shard uint16)
+
+// ShardReadyEvent is sent when the shard is connected with a new session (after READY).
+type ShardReadyEvent func(shard uint16)
+type ShardResumedEvent func(shard uint16, replayed int)
+
+// ShardDisconnectedEvent is sent when the connection is closed (see ws.InternalConnectionClosed).
+// Err is nil if the connection was closed on request.
+type ShardDisconnectedEvent func(shard uint16, code int, err error)
+
+// ShardReconnectingEvent is sent before every reconnection attempt. Err is the error of the previous failed attempt.
+type ShardReconnectingEvent func(shard uint16, attempt uint64, delay time.Duration, err error)
+
+// ShardFullyReadyEvent is sent when the shard received all guilds from READY. Missing is the number of guilds
+// that were not received before the ready timeout.
+type ShardFullyReadyEvent func(shard uint16, guilds int, missing int)
+
+// AllShardsReadyEvent is sent when every shard of the session is fully ready.
+type AllShardsReadyEvent func(shards []uint16)
+
 // Invite events
 
 type InviteCreateEvent func(event *ws.InviteCreateEvent)
@@ -24,6 +49,19 @@ type GuildCreateEvent func(guild *ws.GuildCreateEvent)
 type GuildDeleteEvent func(id snowflake.ID, name string)
 type GuildUpdateEvent func(new, old *discord.Guild)
 
+// GuildJoinEvent is sent when the bot is added to a new guild.
+type GuildJoinEvent func(guild *ws.GuildCreateEvent)
+
+// GuildAvailableEvent is sent when the guild becomes available again after an outage.
+type GuildAvailableEvent func(guild *ws.GuildCreateEvent)
+
+// GuildUnavailableEvent is sent when the guild becomes unavailable due to an outage.
+type GuildUnavailableEvent func(id snowflake.ID)
+
+// GuildLeaveEvent is sent when the bot is removed from the guild (kicked, banned or the guild was deleted).
+// Cached is nil if the guild was not cached.
+type GuildLeaveEvent func(id snowflake.ID, cached *discord.Guild)
+
 type GuildBanAddEvent func(event *ws.GuildBanEvent)
 type GuildBanRemoveEvent func(event *ws.GuildBanEvent)
 
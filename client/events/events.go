@@ -4,11 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/BOOMfinity/golog/v2"
+
+	"github.com/BOOMfinity/bfcord/metrics"
 )
 
 type DispatcherError struct {
@@ -28,20 +32,93 @@ type Listener[T SessionEvents] struct {
 	DeclaredAt string
 	Nonce      bool
 	handler    T
-	cancel     ListenerCancelFn
+	// data is called with the payload instead of handler, if it is set (see WaitFor)
+	data   func(data any)
+	cancel ListenerCancelFn
+	// fired makes sure the nonce listener is called once, even if events are sent concurrently
+	fired atomic.Bool
+}
+
+// EventContext describes the listener call passed to middleware.
+type EventContext struct {
+	// Event is the name of the event type, like MessageCreateEvent.
+	Event string
+	// Data is the payload of the event (usually the first argument of listeners), nil if the event was sent with Sender.
+	Data              any
+	ListenerID        uint64
+	ListenerCreatedAt time.Time
+	DeclaredAt        string
+}
+
+// Error returns err (like a recovered panic value) joined with DispatcherError of the listener.
+func (ctx EventContext) Error(err any) error {
+	disErr := &DispatcherError{
+		ListenerID:        ctx.ListenerID,
+		ListenerCreatedAt: ctx.ListenerCreatedAt,
+		Event:             ctx.Event,
+		DeclaredAt:        ctx.DeclaredAt,
+	}
+	switch v := err.(type) {
+	case error:
+		return errors.Join(disErr, v)
+	default:
+		return errors.Join(disErr, fmt.Errorf("%v", v))
+	}
+}
+
+// Middleware runs before the listener. It calls next to continue with the next middleware and the listener,
+// or skips the listener by returning without calling it.
+type Middleware func(ctx EventContext, next func())
+
+// Recover returns middleware, which recovers panics of following middleware and the listener and passes them
+// to fn as errors containing DispatcherError (see EventContext.Error). Without it, panics are only logged.
+func Recover(fn func(err error)) Middleware {
+	return func(ctx EventContext, next func()) {
+		defer func() {
+			if v := recover(); v != nil {
+				fn(ctx.Error(v))
+			}
+		}()
+		next()
+	}
+}
+
+// middlewares are shared by dispatchers of the session.
+type middlewares struct {
+	mut  sync.RWMutex
+	list []Middleware
+}
+
+func (m *middlewares) use(mw ...Middleware) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.list = append(m.list, mw...)
+}
+
+func (m *middlewares) get() []Middleware {
+	if m == nil {
+		return nil
+	}
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return m.list
 }
 
 type ListenerCancelFn func()
 type DispatcherSendFn[T SessionEvents] func(handler T) error
 
 type SessionEvents interface {
-	ReadyEvent | GuildCreateEvent | GuildDeleteEvent | ChannelCreateEvent | ChannelUpdateEvent | ChannelDeleteEvent | MessageCreateEvent | MessageUpdateEvent | MessageDeleteEvent | ChannelPinsUpdateEvent | GuildUpdateEvent | ThreadCreateEvent | ThreadUpdateEvent | ThreadDeleteEvent | ThreadListSyncEvent | ThreadMembersUpdateEvent | GuildRoleAddEvent | GuildRoleUpdateEvent | GuildRoleDeleteEvent | GuildScheduledCreateEvent | GuildScheduledUpdateEvent | GuildScheduledDeleteEvent | GuildScheduledUserAddEvent | GuildScheduledUserRemoveEvent | GuildMemberAddEvent | GuildMemberUpdateEvent | GuildMemberRemoveEvent | InviteCreateEvent | InviteDeleteEvent | GuildBanAddEvent | GuildBanRemoveEvent | InteractionCreateEvent | VoiceServerUpdateEvent | VoiceStateUpdateEvent
+	ReadyEvent | GuildCreateEvent | GuildDeleteEvent | GuildJoinEvent | GuildAvailableEvent | GuildUnavailableEvent | GuildLeaveEvent | ChannelCreateEvent | ChannelUpdateEvent | ChannelDeleteEvent | MessageCreateEvent | MessageUpdateEvent | MessageDeleteEvent | ChannelPinsUpdateEvent | GuildUpdateEvent | ThreadCreateEvent | ThreadUpdateEvent | ThreadDeleteEvent | ThreadListSyncEvent | ThreadMembersUpdateEvent | GuildRoleAddEvent | GuildRoleUpdateEvent | GuildRoleDeleteEvent | GuildScheduledCreateEvent | GuildScheduledUpdateEvent | GuildScheduledDeleteEvent | GuildScheduledUserAddEvent | GuildScheduledUserRemoveEvent | GuildMemberAddEvent | GuildMemberUpdateEvent | GuildMemberRemoveEvent | InviteCreateEvent | InviteDeleteEvent | GuildBanAddEvent | GuildBanRemoveEvent | InteractionCreateEvent | VoiceServerUpdateEvent | VoiceStateUpdateEvent | ShardConnectingEvent | ShardReadyEvent | ShardResumedEvent | ShardDisconnectedEvent | ShardReconnectingEvent | ShardFullyReadyEvent | AllShardsReadyEvent
 }
 
 type SessionDispatcher interface {
 	Ready() Dispatcher[ReadyEvent]
 	GuildCreate() Dispatcher[GuildCreateEvent]
 	GuildDelete() Dispatcher[GuildDeleteEvent]
+	GuildJoin() Dispatcher[GuildJoinEvent]
+	GuildAvailable() Dispatcher[GuildAvailableEvent]
+	GuildUnavailable() Dispatcher[GuildUnavailableEvent]
+	GuildLeave() Dispatcher[GuildLeaveEvent]
 	ChannelCreate() Dispatcher[ChannelCreateEvent]
 	ChannelUpdate() Dispatcher[ChannelUpdateEvent]
 	ChannelPinsUpdate() Dispatcher[ChannelPinsUpdateEvent]
@@ -73,20 +150,55 @@ type SessionDispatcher interface {
 	InteractionCreate() Dispatcher[InteractionCreateEvent]
 	VoiceStateUpdate() Dispatcher[VoiceStateUpdateEvent]
 	VoiceServerUpdate() Dispatcher[VoiceServerUpdateEvent]
+	ShardConnecting() Dispatcher[ShardConnectingEvent]
+	ShardReady() Dispatcher[ShardReadyEvent]
+	ShardResumed() Dispatcher[ShardResumedEvent]
+	ShardDisconnected() Dispatcher[ShardDisconnectedEvent]
+	ShardReconnecting() Dispatcher[ShardReconnectingEvent]
+	ShardFullyReady() Dispatcher[ShardFullyReadyEvent]
+	AllShardsReady() Dispatcher[AllShardsReadyEvent]
+	// Use adds middleware running before listeners of every event. It runs before middleware of the event.
+	Use(mw ...Middleware)
 }
 
 type Dispatcher[T SessionEvents] interface {
 	Listen(fn T) ListenerCancelFn
 	Nonce(fn T) ListenerCancelFn
+	// Send calls every listener with fn and waits for them. Data is the payload of the event passed to middleware.
+	Send(data any, fn func(handler T))
+	// Sender is Send without the payload.
 	Sender(fn func(handler T))
+	// Use adds middleware running before listeners of this event.
+	Use(mw ...Middleware)
+	// Count returns the number of registered listeners.
+	Count() int
+}
+
+type DispatcherOption func(o *dispatcherOptions)
+
+type dispatcherOptions struct {
+	metrics metrics.Registry
+	global  *middlewares
+}
+
+// WithMetrics reports the number of registered listeners of every event to reg.
+func WithMetrics(reg metrics.Registry) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.metrics = reg
+	}
 }
 
 type dispatcher[T SessionEvents] struct {
 	log       golog.Logger
+	event     string
+	count     metrics.Gauge
+	active    atomic.Int64
 	listeners []*Listener[T]
 	nils      []int
 	mut       sync.RWMutex
 	id        atomic.Uint64
+	global    *middlewares
+	local     middlewares
 }
 
 func (d *dispatcher[T]) createListener() *Listener[T] {
@@ -105,11 +217,19 @@ func (d *dispatcher[T]) createListener() *Listener[T] {
 		index = len(d.listeners)
 		d.listeners = append(d.listeners, listener)
 	}
+	d.active.Add(1)
+	d.count.Add(1, d.event)
 	listener.cancel = func() {
 		d.mut.Lock()
+		defer d.mut.Unlock()
+		// Nonce listeners are cancelled by Sender, so cancel can be called twice
+		if d.listeners[index] != listener {
+			return
+		}
 		d.listeners[index] = nil
 		d.nils = append(d.nils, index)
-		d.mut.Unlock()
+		d.active.Add(-1)
+		d.count.Add(-1, d.event)
 	}
 	return listener
 }
@@ -135,46 +255,86 @@ func (d *dispatcher[T]) Nonce(fn T) ListenerCancelFn {
 	return listener.cancel
 }
 
-func (d *dispatcher[T]) recoverPanic(l *Listener[T], fn func(handler T)) {
+func (d *dispatcher[T]) Count() int {
+	return int(d.active.Load())
+}
+
+func (d *dispatcher[T]) Use(mw ...Middleware) {
+	d.local.use(mw...)
+}
+
+func (d *dispatcher[T]) call(l *Listener[T], data any, chain []Middleware, fn func(handler T)) {
+	ctx := EventContext{
+		Event:             d.event,
+		Data:              data,
+		ListenerID:        l.ID,
+		ListenerCreatedAt: l.CreatedAt,
+		DeclaredAt:        l.DeclaredAt,
+	}
 	defer func() {
 		if err := recover(); err != nil {
-			disErr := &DispatcherError{
-				ListenerID:        l.ID,
-				ListenerCreatedAt: l.CreatedAt,
-				Event:             fmt.Sprintf("%T", l.handler),
-				DeclaredAt:        l.DeclaredAt,
-			}
-
-			switch v := err.(type) {
-			case error:
-				d.log.Error().Throw(errors.Join(disErr, v))
-			default:
-				d.log.Error().Throw(errors.Join(disErr, fmt.Errorf("%v", v)))
-			}
+			d.log.Error().Throw(ctx.Error(err))
 		}
 	}()
-
-	fn(l.handler)
+	var next func()
+	i := 0
+	next = func() {
+		if i == len(chain) {
+			if l.data != nil {
+				l.data(data)
+			} else {
+				fn(l.handler)
+			}
+			return
+		}
+		mw := chain[i]
+		i++
+		mw(ctx, next)
+	}
+	next()
 }
 
 func (d *dispatcher[T]) Sender(fn func(handler T)) {
+	d.Send(nil, fn)
+}
+
+func (d *dispatcher[T]) Send(data any, fn func(handler T)) {
+	// Cancelled listeners leave nil in the slice, which is reused, so listeners are copied
 	d.mut.RLock()
-	listeners := d.listeners[:]
+	listeners := make([]*Listener[T], 0, len(d.listeners))
+	for _, listener := range d.listeners {
+		if listener != nil {
+			listeners = append(listeners, listener)
+		}
+	}
 	d.mut.RUnlock()
+	chain := slices.Concat(d.global.get(), d.local.get())
 	var wg sync.WaitGroup
-	wg.Add(len(listeners))
 	for _, listener := range listeners {
-		go func() {
-			defer wg.Done()
-			d.recoverPanic(listener, fn)
-		}()
 		if listener.Nonce {
+			if !listener.fired.CompareAndSwap(false, true) {
+				continue
+			}
 			listener.cancel()
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.call(listener, data, chain, fn)
+		}()
 	}
 	wg.Wait()
 }
 
-func NewDispatcher[T SessionEvents](log golog.Logger) Dispatcher[T] {
-	return &dispatcher[T]{log: log}
+func NewDispatcher[T SessionEvents](log golog.Logger, opts ...DispatcherOption) Dispatcher[T] {
+	var o dispatcherOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &dispatcher[T]{
+		log:    log,
+		global: o.global,
+		event:  strings.TrimPrefix(fmt.Sprintf("%T", *new(T)), "events."),
+		count:  metrics.Or(o.metrics).Gauge("bfcord_dispatcher_listeners", "Registered event listeners.", "event"),
+	}
 }
@@ -1,12 +1,20 @@
 package events
 
-import "github.com/BOOMfinity/golog/v2"
+import (
+	"slices"
+
+	"github.com/BOOMfinity/golog/v2"
+)
 
 type sessionDispatcher struct {
 	ready                    Dispatcher[ReadyEvent]
 	guildCreate              Dispatcher[GuildCreateEvent]
 	guildUpdate              Dispatcher[GuildUpdateEvent]
 	guildDelete              Dispatcher[GuildDeleteEvent]
+	guildJoin                Dispatcher[GuildJoinEvent]
+	guildAvailable           Dispatcher[GuildAvailableEvent]
+	guildUnavailable         Dispatcher[GuildUnavailableEvent]
+	guildLeave               Dispatcher[GuildLeaveEvent]
 	channelCreate            Dispatcher[ChannelCreateEvent]
 	channelUpdate            Dispatcher[ChannelUpdateEvent]
 	channelDelete            Dispatcher[ChannelDeleteEvent]
@@ -37,6 +45,18 @@ type sessionDispatcher struct {
 	interactionCreate        Dispatcher[InteractionCreateEvent]
 	voiceStateUpdate         Dispatcher[VoiceStateUpdateEvent]
 	voiceServerUpdate        Dispatcher[VoiceServerUpdateEvent]
+	shardConnecting          Dispatcher[ShardConnectingEvent]
+	shardReady               Dispatcher[ShardReadyEvent]
+	shardResumed             Dispatcher[ShardResumedEvent]
+	shardDisconnected        Dispatcher[ShardDisconnectedEvent]
+	shardReconnecting        Dispatcher[ShardReconnectingEvent]
+	shardFullyReady          Dispatcher[ShardFullyReadyEvent]
+	allShardsReady           Dispatcher[AllShardsReadyEvent]
+	middlewares              *middlewares
+}
+
+func (s *sessionDispatcher) Use(mw ...Middleware) {
+	s.middlewares.use(mw...)
 }
 
 func (s *sessionDispatcher) Ready() Dispatcher[ReadyEvent] {
@@ -51,6 +71,22 @@ func (s *sessionDispatcher) GuildDelete() Dispatcher[GuildDeleteEvent] {
 	return s.guildDelete
 }
 
+func (s *sessionDispatcher) GuildJoin() Dispatcher[GuildJoinEvent] {
+	return s.guildJoin
+}
+
+func (s *sessionDispatcher) GuildAvailable() Dispatcher[GuildAvailableEvent] {
+	return s.guildAvailable
+}
+
+func (s *sessionDispatcher) GuildUnavailable() Dispatcher[GuildUnavailableEvent] {
+	return s.guildUnavailable
+}
+
+func (s *sessionDispatcher) GuildLeave() Dispatcher[GuildLeaveEvent] {
+	return s.guildLeave
+}
+
 func (s *sessionDispatcher) ChannelCreate() Dispatcher[ChannelCreateEvent] {
 	return s.channelCreate
 }
@@ -175,41 +211,85 @@ func (s *sessionDispatcher) VoiceServerUpdate() Dispatcher[VoiceServerUpdateEven
 	return s.voiceServerUpdate
 }
 
-func NewSessionDispatcher(log golog.Logger) SessionDispatcher {
+func (s *sessionDispatcher) ShardConnecting() Dispatcher[ShardConnectingEvent] {
+	return s.shardConnecting
+}
+
+func (s *sessionDispatcher) ShardReady() Dispatcher[ShardReadyEvent] {
+	return s.shardReady
+}
+
+func (s *sessionDispatcher) ShardResumed() Dispatcher[ShardResumedEvent] {
+	return s.shardResumed
+}
+
+func (s *sessionDispatcher) ShardDisconnected() Dispatcher[ShardDisconnectedEvent] {
+	return s.shardDisconnected
+}
+
+func (s *sessionDispatcher) ShardReconnecting() Dispatcher[ShardReconnectingEvent] {
+	return s.shardReconnecting
+}
+
+func (s *sessionDispatcher) ShardFullyReady() Dispatcher[ShardFullyReadyEvent] {
+	return s.shardFullyReady
+}
+
+func (s *sessionDispatcher) AllShardsReady() Dispatcher[AllShardsReadyEvent] {
+	return s.allShardsReady
+}
+
+func NewSessionDispatcher(log golog.Logger, opts ...DispatcherOption) SessionDispatcher {
+	global := new(middlewares)
+	opts = append(slices.Clip(opts), func(o *dispatcherOptions) {
+		o.global = global
+	})
 	return &sessionDispatcher{
-		ready:                    NewDispatcher[ReadyEvent](log),
-		guildCreate:              NewDispatcher[GuildCreateEvent](log),
-		guildUpdate:              NewDispatcher[GuildUpdateEvent](log),
-		guildDelete:              NewDispatcher[GuildDeleteEvent](log),
-		channelCreate:            NewDispatcher[ChannelCreateEvent](log),
-		channelUpdate:            NewDispatcher[ChannelUpdateEvent](log),
-		channelDelete:            NewDispatcher[ChannelDeleteEvent](log),
-		channelPinsUpdate:        NewDispatcher[ChannelPinsUpdateEvent](log),
-		messageCreate:            NewDispatcher[MessageCreateEvent](log),
-		messageUpdate:            NewDispatcher[MessageUpdateEvent](log),
-		messageDelete:            NewDispatcher[MessageDeleteEvent](log),
-		threadCreate:             NewDispatcher[ThreadCreateEvent](log),
-		threadUpdate:             NewDispatcher[ThreadUpdateEvent](log),
-		threadDelete:             NewDispatcher[ThreadDeleteEvent](log),
-		threadListSync:           NewDispatcher[ThreadListSyncEvent](log),
-		threadMembersUpdate:      NewDispatcher[ThreadMembersUpdateEvent](log),
-		guildRoleAdd:             NewDispatcher[GuildRoleAddEvent](log),
-		guildRoleUpdate:          NewDispatcher[GuildRoleUpdateEvent](log),
-		guildRoleDelete:          NewDispatcher[GuildRoleDeleteEvent](log),
-		guildScheduledCreate:     NewDispatcher[GuildScheduledCreateEvent](log),
-		guildScheduledUpdate:     NewDispatcher[GuildScheduledUpdateEvent](log),
-		guildScheduledDelete:     NewDispatcher[GuildScheduledDeleteEvent](log),
-		guildScheduledUserAdd:    NewDispatcher[GuildScheduledUserAddEvent](log),
-		guildScheduledUserRemove: NewDispatcher[GuildScheduledUserRemoveEvent](log),
-		guildMemberAdd:           NewDispatcher[GuildMemberAddEvent](log),
-		guildMemberRemove:        NewDispatcher[GuildMemberRemoveEvent](log),
-		guildMemberUpdate:        NewDispatcher[GuildMemberUpdateEvent](log),
-		inviteCreate:             NewDispatcher[InviteCreateEvent](log),
-		inviteDelete:             NewDispatcher[InviteDeleteEvent](log),
-		guildBanAdd:              NewDispatcher[GuildBanAddEvent](log),
-		guildBanRemove:           NewDispatcher[GuildBanRemoveEvent](log),
-		interactionCreate:        NewDispatcher[InteractionCreateEvent](log),
-		voiceStateUpdate:         NewDispatcher[VoiceStateUpdateEvent](log),
-		voiceServerUpdate:        NewDispatcher[VoiceServerUpdateEvent](log),
+		middlewares:              global,
+		ready:                    NewDispatcher[ReadyEvent](log, opts...),
+		guildCreate:              NewDispatcher[GuildCreateEvent](log, opts...),
+		guildUpdate:              NewDispatcher[GuildUpdateEvent](log, opts...),
+		guildDelete:              NewDispatcher[GuildDeleteEvent](log, opts...),
+		guildJoin:                NewDispatcher[GuildJoinEvent](log, opts...),
+		guildAvailable:           NewDispatcher[GuildAvailableEvent](log, opts...),
+		guildUnavailable:         NewDispatcher[GuildUnavailableEvent](log, opts...),
+		guildLeave:               NewDispatcher[GuildLeaveEvent](log, opts...),
+		channelCreate:            NewDispatcher[ChannelCreateEvent](log, opts...),
+		channelUpdate:            NewDispatcher[ChannelUpdateEvent](log, opts...),
+		channelDelete:            NewDispatcher[ChannelDeleteEvent](log, opts...),
+		channelPinsUpdate:        NewDispatcher[ChannelPinsUpdateEvent](log, opts...),
+		messageCreate:            NewDispatcher[MessageCreateEvent](log, opts...),
+		messageUpdate:            NewDispatcher[MessageUpdateEvent](log, opts...),
+		messageDelete:            NewDispatcher[MessageDeleteEvent](log, opts...),
+		threadCreate:             NewDispatcher[ThreadCreateEvent](log, opts...),
+		threadUpdate:             NewDispatcher[ThreadUpdateEvent](log, opts...),
+		threadDelete:             NewDispatcher[ThreadDeleteEvent](log, opts...),
+		threadListSync:           NewDispatcher[ThreadListSyncEvent](log, opts...),
+		threadMembersUpdate:      NewDispatcher[ThreadMembersUpdateEvent](log, opts...),
+		guildRoleAdd:             NewDispatcher[GuildRoleAddEvent](log, opts...),
+		guildRoleUpdate:          NewDispatcher[GuildRoleUpdateEvent](log, opts...),
+		guildRoleDelete:          NewDispatcher[GuildRoleDeleteEvent](log, opts...),
+		guildScheduledCreate:     NewDispatcher[GuildScheduledCreateEvent](log, opts...),
+		guildScheduledUpdate:     NewDispatcher[GuildScheduledUpdateEvent](log, opts...),
+		guildScheduledDelete:     NewDispatcher[GuildScheduledDeleteEvent](log, opts...),
+		guildScheduledUserAdd:    NewDispatcher[GuildScheduledUserAddEvent](log, opts...),
+		guildScheduledUserRemove: NewDispatcher[GuildScheduledUserRemoveEvent](log, opts...),
+		guildMemberAdd:           NewDispatcher[GuildMemberAddEvent](log, opts...),
+		guildMemberRemove:        NewDispatcher[GuildMemberRemoveEvent](log, opts...),
+		guildMemberUpdate:        NewDispatcher[GuildMemberUpdateEvent](log, opts...),
+		inviteCreate:             NewDispatcher[InviteCreateEvent](log, opts...),
+		inviteDelete:             NewDispatcher[InviteDeleteEvent](log, opts...),
+		guildBanAdd:              NewDispatcher[GuildBanAddEvent](log, opts...),
+		guildBanRemove:           NewDispatcher[GuildBanRemoveEvent](log, opts...),
+		interactionCreate:        NewDispatcher[InteractionCreateEvent](log, opts...),
+		voiceStateUpdate:         NewDispatcher[VoiceStateUpdateEvent](log, opts...),
+		voiceServerUpdate:        NewDispatcher[VoiceServerUpdateEvent](log, opts...),
+		shardConnecting:          NewDispatcher[ShardConnectingEvent](log, opts...),
+		shardReady:               NewDispatcher[ShardReadyEvent](log, opts...),
+		shardResumed:             NewDispatcher[ShardResumedEvent](log, opts...),
+		shardDisconnected:        NewDispatcher[ShardDisconnectedEvent](log, opts...),
+		shardReconnecting:        NewDispatcher[ShardReconnectingEvent](log, opts...),
+		shardFullyReady:          NewDispatcher[ShardFullyReadyEvent](log, opts...),
+		allShardsReady:           NewDispatcher[AllShardsReadyEvent](log, opts...),
 	}
 }
@@ -18,7 +18,7 @@ var channelCreateEventHandler = handle[discord.Channel](func(log golog.Logger, s
 		}
 	}
 
-	sess.Events().ChannelCreate().Sender(func(handler events.ChannelCreateEvent) {
+	sess.Events().ChannelCreate().Send(data, func(handler events.ChannelCreateEvent) {
 		handler(data)
 	})
 })
@@ -37,7 +37,7 @@ var channelUpdateEventHandler = handle[discord.Channel](func(log golog.Logger, s
 		}
 	}
 
-	sess.Events().ChannelUpdate().Sender(func(handler events.ChannelUpdateEvent) {
+	sess.Events().ChannelUpdate().Send(data, func(handler events.ChannelUpdateEvent) {
 		handler(data, cached)
 	})
 })
@@ -49,7 +49,7 @@ var channelDeleteEventHandler = handle[discord.Channel](func(log golog.Logger, s
 		}
 	}
 
-	sess.Events().ChannelDelete().Sender(func(handler events.ChannelDeleteEvent) {
+	sess.Events().ChannelDelete().Send(data, func(handler events.ChannelDeleteEvent) {
 		handler(data)
 	})
 })
@@ -64,7 +64,7 @@ var channelPinsUpdateEventHandler = handle[ws.ChannelPinsUpdateEvent](func(log g
 		}
 	}
 
-	sess.Events().ChannelPinsUpdate().Sender(func(handler events.ChannelPinsUpdateEvent) {
+	sess.Events().ChannelPinsUpdate().Send(data, func(handler events.ChannelPinsUpdateEvent) {
 		handler(data)
 	})
 })
@@ -76,7 +76,7 @@ var threadCreateEventHandler = handle[ws.ThreadCreateEvent](func(log golog.Logge
 		}
 	}
 
-	sess.Events().ThreadCreate().Sender(func(handler events.ThreadCreateEvent) {
+	sess.Events().ThreadCreate().Send(data, func(handler events.ThreadCreateEvent) {
 		handler(data)
 	})
 })
@@ -93,7 +93,7 @@ var threadUpdateEventHandler = handle[discord.Channel](func(log golog.Logger, se
 		}
 	}
 
-	sess.Events().ThreadUpdate().Sender(func(handler events.ThreadUpdateEvent) {
+	sess.Events().ThreadUpdate().Send(data, func(handler events.ThreadUpdateEvent) {
 		handler(data, cached)
 	})
 })
@@ -109,7 +109,7 @@ var threadDeleteEventHandler = handle[ws.ThreadDeleteEvent](func(log golog.Logge
 		}
 	}
 
-	sess.Events().ThreadDelete().Sender(func(handler events.ThreadDeleteEvent) {
+	sess.Events().ThreadDelete().Send(data, func(handler events.ThreadDeleteEvent) {
 		handler(data, cached)
 	})
 })
@@ -151,13 +151,13 @@ var threadListSyncEventHandler = handle[ws.ThreadListSyncEvent](func(log golog.L
 		}
 	}
 
-	sess.Events().ThreadListSync().Sender(func(handler events.ThreadListSyncEvent) {
+	sess.Events().ThreadListSync().Send(data, func(handler events.ThreadListSyncEvent) {
 		handler(data)
 	})
 })
 
 var threadMembersUpdateEventHandler = handle[ws.ThreadMembersUpdateEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.ThreadMembersUpdateEvent) {
-	sess.Events().ThreadMembersUpdate().Sender(func(handler events.ThreadMembersUpdateEvent) {
+	sess.Events().ThreadMembersUpdate().Send(data, func(handler events.ThreadMembersUpdateEvent) {
 		handler(data)
 	})
 })
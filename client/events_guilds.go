@@ -62,10 +62,19 @@ var guildCreateEventHandler = handle[ws.GuildCreateEvent](func(log golog.Logger,
 		if shard.Unavailable().Size() == 0 {
 			log.Debug().Send("All unavailable guilds fetched")
 		}
-		return
+		if shard.(*shardImpl).lazyLoaded(data.ID) {
+			return
+		}
+		sess.Events().GuildAvailable().Send(data, func(handler events.GuildAvailableEvent) {
+			handler(data)
+		})
+	} else {
+		sess.Events().GuildJoin().Send(data, func(handler events.GuildJoinEvent) {
+			handler(data)
+		})
 	}
 
-	sess.Events().GuildCreate().Sender(func(handler events.GuildCreateEvent) {
+	sess.Events().GuildCreate().Send(data, func(handler events.GuildCreateEvent) {
 		handler(data)
 	})
 })
@@ -81,19 +90,39 @@ var guildUpdateEventHandler = handle[discord.Guild](func(log golog.Logger, sess
 			log.Error().Throw(fmt.Errorf("failed to save guild: %w", err))
 		}
 	}
-	sess.Events().GuildUpdate().Sender(func(handler events.GuildUpdateEvent) {
+	sess.Events().GuildUpdate().Send(data, func(handler events.GuildUpdateEvent) {
 		handler(data, cached)
 	})
 })
 
-var guildDeleteEventHandler = handle[ws.UnavailableGuild](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.UnavailableGuild) {
-	if sess.Cache() != nil && !data.Unavailable {
-		if err := sess.Cache().Guilds().Delete(data.ID); err != nil {
-			log.Error().Throw(fmt.Errorf("failed to delete guild: %w", err))
+var guildDeleteEventHandler = handle[ws.UnavailableGuild](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, shard Shard, data *ws.UnavailableGuild) {
+	// Guild from READY is not going to be loaded lazily anymore
+	shard.(*shardImpl).lazyLoaded(data.ID)
+	if data.Unavailable {
+		_, known := shard.Unavailable().Get(data.ID)
+		shard.Unavailable().Set(data.ID, *data)
+		if !known {
+			sess.Events().GuildUnavailable().Send(data, func(handler events.GuildUnavailableEvent) {
+				handler(data.ID)
+			})
+		}
+	} else {
+		shard.Unavailable().Delete(data.ID)
+		var cached *discord.Guild
+		if sess.Cache() != nil {
+			if obj, err := sess.Cache().Guilds().Get(data.ID); err == nil {
+				cached = &obj
+			}
+			if err := sess.Cache().Guilds().Delete(data.ID); err != nil {
+				log.Error().Throw(fmt.Errorf("failed to delete guild: %w", err))
+			}
 		}
+		sess.Events().GuildLeave().Send(data, func(handler events.GuildLeaveEvent) {
+			handler(data.ID, cached)
+		})
 	}
 
-	sess.Events().GuildDelete().Sender(func(handler events.GuildDeleteEvent) {
+	sess.Events().GuildDelete().Send(data, func(handler events.GuildDeleteEvent) {
 		handler(data.ID, data.Name)
 	})
 })
@@ -101,11 +130,11 @@ var guildDeleteEventHandler = handle[ws.UnavailableGuild](func(log golog.Logger,
 var guildBan = func(add bool) handleDispatchFn {
 	return handle[ws.GuildBanEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.GuildBanEvent) {
 		if add {
-			sess.Events().GuildBanAdd().Sender(func(handler events.GuildBanAddEvent) {
+			sess.Events().GuildBanAdd().Send(data, func(handler events.GuildBanAddEvent) {
 				handler(data)
 			})
 		} else {
-			sess.Events().GuildBanRemove().Sender(func(handler events.GuildBanRemoveEvent) {
+			sess.Events().GuildBanRemove().Send(data, func(handler events.GuildBanRemoveEvent) {
 				handler(data)
 			})
 		}
@@ -136,11 +165,11 @@ var guildRoleEventHandler = func(update bool) handleDispatchFn {
 		}
 
 		if update {
-			sess.Events().GuildRoleUpdate().Sender(func(handler events.GuildRoleUpdateEvent) {
+			sess.Events().GuildRoleUpdate().Send(data, func(handler events.GuildRoleUpdateEvent) {
 				handler(data, cached)
 			})
 		} else {
-			sess.Events().GuildRoleAdd().Sender(func(handler events.GuildRoleAddEvent) {
+			sess.Events().GuildRoleAdd().Send(data, func(handler events.GuildRoleAddEvent) {
 				handler(data)
 			})
 		}
@@ -164,7 +193,7 @@ var guildRoleDeleteEventHandler = handle[ws.GuildRoleDeleteEvent](func(log golog
 		}
 	}
 
-	sess.Events().GuildRoleDelete().Sender(func(handler events.GuildRoleDeleteEvent) {
+	sess.Events().GuildRoleDelete().Send(data, func(handler events.GuildRoleDeleteEvent) {
 		handler(data, cached)
 	})
 })
@@ -197,15 +226,15 @@ var guildScheduledEventHandler = func(t string) handleDispatchFn {
 
 		switch t {
 		case "create":
-			sess.Events().GuildScheduledCreate().Sender(func(handler events.GuildScheduledCreateEvent) {
+			sess.Events().GuildScheduledCreate().Send(data, func(handler events.GuildScheduledCreateEvent) {
 				handler(data)
 			})
 		case "update":
-			sess.Events().GuildScheduledUpdate().Sender(func(handler events.GuildScheduledUpdateEvent) {
+			sess.Events().GuildScheduledUpdate().Send(data, func(handler events.GuildScheduledUpdateEvent) {
 				handler(data, cached)
 			})
 		case "delete":
-			sess.Events().GuildScheduledDelete().Sender(func(handler events.GuildScheduledDeleteEvent) {
+			sess.Events().GuildScheduledDelete().Send(data, func(handler events.GuildScheduledDeleteEvent) {
 				handler(data)
 			})
 		}
@@ -215,11 +244,11 @@ var guildScheduledEventHandler = func(t string) handleDispatchFn {
 var guildScheduledUserEventHandler = func(removed bool) handleDispatchFn {
 	return handle[ws.GuildScheduledUserEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.GuildScheduledUserEvent) {
 		if removed {
-			sess.Events().GuildScheduledUserRemove().Sender(func(handler events.GuildScheduledUserRemoveEvent) {
+			sess.Events().GuildScheduledUserRemove().Send(data, func(handler events.GuildScheduledUserRemoveEvent) {
 				handler(data)
 			})
 		} else {
-			sess.Events().GuildScheduledUserAdd().Sender(func(handler events.GuildScheduledUserAddEvent) {
+			sess.Events().GuildScheduledUserAdd().Send(data, func(handler events.GuildScheduledUserAddEvent) {
 				handler(data)
 			})
 		}
@@ -233,7 +262,7 @@ var guildMemberAddEventHandler = handle[ws.GuildMemberAddEvent](func(log golog.L
 		}
 	}
 
-	sess.Events().GuildMemberAdd().Sender(func(handler events.GuildMemberAddEvent) {
+	sess.Events().GuildMemberAdd().Send(data, func(handler events.GuildMemberAddEvent) {
 		handler(data)
 	})
 })
@@ -253,7 +282,7 @@ var guildMemberUpdateEventHandler = handle[ws.GuildMemberUpdateEvent](func(log g
 		}
 	}
 
-	sess.Events().GuildMemberUpdate().Sender(func(handler events.GuildMemberUpdateEvent) {
+	sess.Events().GuildMemberUpdate().Send(data, func(handler events.GuildMemberUpdateEvent) {
 		handler(data, cached)
 	})
 })
@@ -270,7 +299,7 @@ var guildMemberRemoveEventHandler = handle[ws.GuildMemberRemoveEvent](func(log g
 		}
 	}
 
-	sess.Events().GuildMemberRemove().Sender(func(handler events.GuildMemberRemoveEvent) {
+	sess.Events().GuildMemberRemove().Send(data, func(handler events.GuildMemberRemoveEvent) {
 		handler(data, cached)
 	})
 })
@@ -7,12 +7,12 @@ import (
 )
 
 var inviteCreateEventHandler = handle[ws.InviteCreateEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.InviteCreateEvent) {
-	sess.Events().InviteCreate().Sender(func(handler events.InviteCreateEvent) {
+	sess.Events().InviteCreate().Send(data, func(handler events.InviteCreateEvent) {
 		handler(data)
 	})
 })
 var inviteDeleteEventHandler = handle[ws.InviteDeleteEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.InviteDeleteEvent) {
-	sess.Events().InviteDelete().Sender(func(handler events.InviteDeleteEvent) {
+	sess.Events().InviteDelete().Send(data, func(handler events.InviteDeleteEvent) {
 		handler(data)
 	})
 })
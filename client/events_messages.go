@@ -48,7 +48,7 @@ var messageCreateEventHandler = handle[ws.MessageCreateEvent](func(log golog.Log
 		}
 	}
 
-	sess.Events().MessageCreate().Sender(func(handler events.MessageCreateEvent) {
+	sess.Events().MessageCreate().Send(data, func(handler events.MessageCreateEvent) {
 		handler(data)
 	})
 })
@@ -82,7 +82,7 @@ var messageUpdateEventHandler = handle[ws.MessageCreateEvent](func(log golog.Log
 			}
 		}
 	}
-	sess.Events().MessageUpdate().Sender(func(handler events.MessageUpdateEvent) {
+	sess.Events().MessageUpdate().Send(data, func(handler events.MessageUpdateEvent) {
 		handler(data, cached)
 	})
 })
@@ -98,7 +98,7 @@ var messageDeleteEventHandler = handle[ws.MessageDeleteEvent](func(log golog.Log
 		}
 	}
 
-	sess.Events().MessageDelete().Sender(func(handler events.MessageDeleteEvent) {
+	sess.Events().MessageDelete().Send(data, func(handler events.MessageDeleteEvent) {
 		handler(data, cached)
 	})
 })
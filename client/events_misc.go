@@ -8,20 +8,16 @@ import (
 	"github.com/BOOMfinity/golog/v2"
 )
 
-var readyEventHandler = handle[ws.ReadyEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, shard Shard, data *ws.ReadyEvent) {
+var readyEventHandler = handle[ws.ReadyEvent](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *ws.ReadyEvent) {
 	if sess.Cache() != nil {
 		if err := sess.Cache().Users().Set(data.User.ID, data.User); err != nil {
 			log.Error().Throw(fmt.Errorf("failed to save user: %w", err))
 		}
 	}
 
-	for _, v := range data.Guilds {
-		shard.Unavailable().Set(v.ID, v)
-	}
-
-	log.Debug().Send("%d unavailable guilds added waiting to be loaded from GUILD_CREATE event", shard.Unavailable().Size())
+	log.Debug().Send("%d unavailable guilds added waiting to be loaded from GUILD_CREATE event", len(data.Guilds))
 
-	sess.Events().Ready().Sender(func(handler events.ReadyEvent) {
+	sess.Events().Ready().Send(data, func(handler events.ReadyEvent) {
 		handler(sess.Shards(), sess.ShardCount(), data)
 	})
 })
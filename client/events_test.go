@@ -0,0 +1,60 @@
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/bfcord/ws"
+	"github.com/BOOMfinity/bfcord/ws/wstest"
+)
+
+func TestShardEventsSlowListener(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	sess := startSession(t, srv, newCreator().ReconnectPolicy(ws.NewBackoffPolicy(10*time.Millisecond, 50*time.Millisecond, 0)))
+
+	var (
+		mut      sync.Mutex
+		received []string
+		release  = make(chan struct{})
+		messages = make(chan string, 1)
+	)
+	defer close(release)
+	sess.Events().ShardDisconnected().Listen(func(uint16, int, error) {
+		mut.Lock()
+		received = append(received, "disconnected")
+		mut.Unlock()
+		// Like an alert sent over HTTP
+		<-release
+	})
+	sess.Events().ShardReconnecting().Listen(func(uint16, uint64, time.Duration, error) {
+		mut.Lock()
+		received = append(received, "reconnecting")
+		mut.Unlock()
+	})
+	sess.Events().MessageCreate().Listen(func(msg *ws.MessageCreateEvent) {
+		messages <- msg.Content
+	})
+
+	if err := srv.CloseShard(0, 4000, "unknown error"); err != nil {
+		t.Fatalf("failed to close shard: %s", err)
+	}
+	if _, err := srv.WaitFor(testContext(t), wstest.Op(6)); err != nil {
+		t.Fatalf("shard was not resumed: %s", err)
+	}
+	if err := srv.Dispatch(0, "MESSAGE_CREATE", map[string]any{"id": "1", "channel_id": "1", "content": "hello"}); err != nil {
+		t.Fatalf("failed to dispatch message: %s", err)
+	}
+	select {
+	case <-messages:
+	case <-testContext(t).Done():
+		t.Fatal("message was not handled while a shard event listener was blocked")
+	}
+	mut.Lock()
+	defer mut.Unlock()
+	// Next events of the shard wait for the blocked listener
+	if len(received) != 1 || received[0] != "disconnected" {
+		t.Fatalf("expected only the disconnected event, got %v", received)
+	}
+}
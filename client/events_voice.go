@@ -17,13 +17,13 @@ var handleVoiceStateUpdate = handle[voice.StateUpdateEvent](func(log golog.Logge
 			sess.Cache().VoiceStates().Get(data.GuildID).Set(data.UserID, *data)
 		}
 	}
-	sess.Events().VoiceStateUpdate().Sender(func(handler events.VoiceStateUpdateEvent) {
+	sess.Events().VoiceStateUpdate().Send(data, func(handler events.VoiceStateUpdateEvent) {
 		handler(data)
 	})
 })
 
 var handleVoiceServerUpdate = handle[voice.ServerUpdateEvent](func(log golog.Logger, sess Session, _ *ws.Event, _ Shard, data *voice.ServerUpdateEvent) {
-	sess.Events().VoiceServerUpdate().Sender(func(handler events.VoiceServerUpdateEvent) {
+	sess.Events().VoiceServerUpdate().Send(data, func(handler events.VoiceServerUpdateEvent) {
 		handler(data)
 	})
 })
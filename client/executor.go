@@ -0,0 +1,178 @@
+package client
+
+import (
+	"cmp"
+	"runtime"
+	"sync"
+
+	"github.com/andersfylling/snowflake/v5"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+// defaultQueueSize is the number of dispatches waiting in the ordered executor, before shards stop reading new ones.
+const defaultQueueSize = 4096
+
+// Executor runs dispatch handlers. Execute is called from the event loop of the shard, in order of dispatches,
+// so it should not block for long. Close is called by Session.Shutdown after all handlers are finished.
+type Executor interface {
+	Execute(ev ws.InternalDispatchEvent, fn func())
+	Close()
+}
+
+// DispatchKey returns the ID dispatches are ordered by: the guild of the dispatch or the channel of dispatches
+// without a guild (like DM messages). Dispatches without both (like READY) have key 0. Only top-level keys
+// of the payload are scanned (see ws.PeekIDs), so it is cheap even for large GUILD_CREATE payloads.
+func DispatchKey(ev ws.InternalDispatchEvent) snowflake.ID {
+	switch ev.Event {
+	case "GUILD_CREATE", "GUILD_UPDATE", "GUILD_DELETE":
+		ids, _ := ws.PeekIDs(ev.Data, "id")
+		return ids[0]
+	}
+	ids, _ := ws.PeekIDs(ev.Data, "guild_id", "channel_id")
+	return cmp.Or(ids[0], ids[1])
+}
+
+type goroutineExecutor struct{}
+
+func (goroutineExecutor) Execute(_ ws.InternalDispatchEvent, fn func()) {
+	go fn()
+}
+
+func (goroutineExecutor) Close() {}
+
+// NewGoroutineExecutor runs every dispatch in a new goroutine, so dispatches are handled in any order.
+// It is used by default.
+func NewGoroutineExecutor() Executor {
+	return goroutineExecutor{}
+}
+
+type OrderedExecutorOption func(e *orderedExecutor)
+
+// WithQueueSize sets how many dispatches can wait for workers. When the queue is full, shards stop reading
+// new dispatches until there is space. Default is 4096.
+func WithQueueSize(size int) OrderedExecutorOption {
+	return func(e *orderedExecutor) {
+		e.queueSize = size
+	}
+}
+
+// keyQueue holds dispatches of one key. It is in orderedExecutor.queues as long as it has dispatches
+// or one of them is running.
+type keyQueue struct {
+	key snowflake.ID
+	fns []func()
+}
+
+type orderedExecutor struct {
+	queueSize int
+	mut       sync.Mutex
+	queues    map[snowflake.ID]*keyQueue
+	// ready are queues waiting for a worker, every queue is there at most once
+	ready chan *keyQueue
+	// slots limits the number of queued dispatches
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func (e *orderedExecutor) Execute(ev ws.InternalDispatchEvent, fn func()) {
+	key := DispatchKey(ev)
+	e.slots <- struct{}{}
+	e.mut.Lock()
+	if e.closed {
+		// Workers are gone, so the dispatch is handled right away
+		e.mut.Unlock()
+		<-e.slots
+		fn()
+		return
+	}
+	defer e.mut.Unlock()
+	if q, ok := e.queues[key]; ok {
+		q.fns = append(q.fns, fn)
+		return
+	}
+	q := &keyQueue{key: key, fns: []func(){fn}}
+	e.queues[key] = q
+	// There are never more queues than slots, so it does not block
+	e.ready <- q
+}
+
+func (e *orderedExecutor) worker() {
+	defer e.wg.Done()
+	for q := range e.ready {
+		e.mut.Lock()
+		fn := q.fns[0]
+		q.fns = q.fns[1:]
+		e.mut.Unlock()
+		fn()
+		<-e.slots
+		e.mut.Lock()
+		switch {
+		case len(q.fns) == 0:
+			delete(e.queues, q.key)
+		case e.closed:
+			// ready is closed, so the rest of the queue is handled by this worker
+			e.mut.Unlock()
+			e.drain(q)
+			e.mut.Lock()
+		default:
+			// Queue goes back to the end, so busy guilds do not take the worker from other ones
+			e.ready <- q
+		}
+		e.mut.Unlock()
+	}
+}
+
+func (e *orderedExecutor) drain(q *keyQueue) {
+	for {
+		e.mut.Lock()
+		if len(q.fns) == 0 {
+			delete(e.queues, q.key)
+			e.mut.Unlock()
+			return
+		}
+		fn := q.fns[0]
+		q.fns = q.fns[1:]
+		e.mut.Unlock()
+		fn()
+		<-e.slots
+	}
+}
+
+// Close waits for queued dispatches to be handled. Dispatches executed after that are handled by the caller.
+func (e *orderedExecutor) Close() {
+	e.mut.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.ready)
+	}
+	e.mut.Unlock()
+	e.wg.Wait()
+}
+
+// NewOrderedExecutor runs dispatches on a fixed number of workers (GOMAXPROCS if workers is less than 1).
+// Dispatches with the same key (see DispatchKey) are handled one by one, in order they were received,
+// while dispatches of different guilds run in parallel. A listener waiting for another dispatch of the same
+// guild (like events.WaitFor) blocks that guild until it returns, so the dispatch it waits for is never handled
+// in the meantime. Such listeners have to wait in a separate goroutine.
+func NewOrderedExecutor(workers int, opts ...OrderedExecutorOption) Executor {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	e := &orderedExecutor{
+		queueSize: defaultQueueSize,
+		queues:    make(map[snowflake.ID]*keyQueue),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.queueSize = max(e.queueSize, 1)
+	e.ready = make(chan *keyQueue, e.queueSize)
+	e.slots = make(chan struct{}, e.queueSize)
+	e.wg.Add(workers)
+	for range workers {
+		go e.worker()
+	}
+	return e
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andersfylling/snowflake/v5"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+func dispatch(event, data string) ws.InternalDispatchEvent {
+	return &ws.Event{Event: event, Data: []byte(data)}
+}
+
+func TestDispatchKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		ev       ws.InternalDispatchEvent
+		expected snowflake.ID
+	}{
+		{name: "guild event", ev: dispatch("GUILD_CREATE", `{"id":"5","channels":[{"id":"6","guild_id":"5"}]}`), expected: 5},
+		{name: "guild id", ev: dispatch("MESSAGE_CREATE", `{"id":"1","channel_id":"2","guild_id":"3"}`), expected: 3},
+		{name: "direct message", ev: dispatch("MESSAGE_CREATE", `{"id":"1","channel_id":"2"}`), expected: 2},
+		{name: "nested ids", ev: dispatch("PRESENCE_UPDATE", `{"user":{"guild_id":"9"},"guild_id":"4"}`), expected: 4},
+		{name: "no ids", ev: dispatch("READY", `{"v":10,"guilds":[{"id":"1"}]}`), expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := DispatchKey(test.ev); key != test.expected {
+				t.Fatalf("expected %d, got %d", test.expected, key)
+			}
+		})
+	}
+}
+
+func TestOrderedExecutor(t *testing.T) {
+	e := NewOrderedExecutor(4, WithQueueSize(16))
+	defer e.Close()
+	const perGuild = 50
+	var (
+		mut   sync.Mutex
+		order = make(map[string][]int)
+		wg    sync.WaitGroup
+	)
+	guilds := []string{"1", "2", "3"}
+	wg.Add(perGuild * len(guilds))
+	for i := range perGuild {
+		for _, guild := range guilds {
+			e.Execute(dispatch("MESSAGE_CREATE", `{"guild_id":"`+guild+`"}`), func() {
+				defer wg.Done()
+				mut.Lock()
+				order[guild] = append(order[guild], i)
+				mut.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+	for _, guild := range guilds {
+		for i, n := range order[guild] {
+			if n != i {
+				t.Fatalf("guild %s: dispatches handled out of order: %v", guild, order[guild])
+			}
+		}
+	}
+}
+
+func TestOrderedExecutorParallel(t *testing.T) {
+	e := NewOrderedExecutor(2)
+	defer e.Close()
+	// Dispatch of the second guild is handled while the first guild is blocked
+	block := make(chan struct{})
+	defer close(block)
+	var handled atomic.Bool
+	done := make(chan struct{})
+	e.Execute(dispatch("MESSAGE_CREATE", `{"guild_id":"1"}`), func() {
+		<-block
+	})
+	e.Execute(dispatch("MESSAGE_CREATE", `{"guild_id":"1"}`), func() {
+		handled.Store(true)
+	})
+	e.Execute(dispatch("MESSAGE_CREATE", `{"guild_id":"2"}`), func() {
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch of another guild was blocked")
+	}
+	if handled.Load() {
+		t.Fatal("dispatch was handled before the previous one of the same guild")
+	}
+}
+
+func TestOrderedExecutorClosed(t *testing.T) {
+	e := NewOrderedExecutor(1)
+	e.Close()
+	// Shard still handling received events after the executor was closed
+	var handled bool
+	e.Execute(dispatch("MESSAGE_CREATE", `{"guild_id":"1"}`), func() {
+		handled = true
+	})
+	if !handled {
+		t.Fatal("dispatch executed after Close was not handled")
+	}
+}
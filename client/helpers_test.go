@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+	"github.com/andersfylling/snowflake/v5"
+
+	"github.com/BOOMfinity/bfcord/discord"
+	"github.com/BOOMfinity/bfcord/ws"
+	"github.com/BOOMfinity/bfcord/ws/wstest"
+)
+
+const testToken = "token"
+
+// testLogger discards logs. Color engine of golog reuses its buffers concurrently, which is reported by the race detector.
+var testLogger = golog.NewCustom("test", func(golog.Message) {})
+
+// newCreator returns Creator with the test logger.
+func newCreator() Creator {
+	return New().Logger(testLogger)
+}
+
+func testGuilds(n int) []ws.GuildCreateEvent {
+	guilds := make([]ws.GuildCreateEvent, n)
+	for i := range guilds {
+		guilds[i].Guild = discord.Guild{ID: snowflake.ID(uint64(i+1) << 22), Name: "guild"}
+	}
+	return guilds
+}
+
+// startSession builds the session connected to srv and waits until it is ready. It is shut down after the test.
+func startSession(t *testing.T, srv *wstest.Server, ctr Creator) Session {
+	t.Helper()
+	sess, err := ctr.GatewayInfo(srv).Build(testToken)
+	if err != nil {
+		t.Fatalf("failed to build session: %s", err)
+	}
+	go sess.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = sess.WaitReady(ctx); err != nil {
+		t.Fatalf("session is not ready: %s", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = sess.Shutdown(ctx)
+	})
+	return sess
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
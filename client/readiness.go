@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/andersfylling/snowflake/v5"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/client/events"
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+// defaultReadyTimeout is how long the shard waits for guilds from READY, before it is reported as fully ready anyway.
+const defaultReadyTimeout = time.Minute
+
+// readiness tracks guilds from READY, which were not received with GUILD_CREATE yet. It is guarded by shardImpl.mut.
+type readiness struct {
+	pending map[snowflake.ID]struct{}
+	// lazy are guilds from READY, which were not handled yet. Unlike pending, they are removed by guild handlers,
+	// as they run in any order.
+	lazy   map[snowflake.ID]struct{}
+	guilds int
+	ready  bool
+	timer  *time.Timer
+	// generation changes with every READY, so the timer of the previous session does nothing
+	generation uint64
+}
+
+func (s *shardImpl) fullyReady() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.readiness.ready
+}
+
+// lazyLoaded reports whether the guild is loaded lazily after READY, rather than being back after an outage.
+func (s *shardImpl) lazyLoaded(id snowflake.ID) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	_, ok := s.readiness.lazy[id]
+	delete(s.readiness.lazy, id)
+	return ok
+}
+
+// trackReadiness is called from handleEvents for every dispatch, before it is handled. It returns true if the dispatch
+// completes the shard, which should be reported (with completeReadiness) after the dispatch handler is finished.
+func (s *sessionImpl) trackReadiness(shard *shardImpl, ev ws.InternalDispatchEvent) bool {
+	switch ev.Event {
+	case "READY":
+		var ready struct {
+			Guilds []ws.UnavailableGuild `json:"guilds"`
+		}
+		if err := json.Unmarshal(ev.Data, &ready); err != nil {
+			s.log.Error().Param("shard", shard.ID()).Send("Failed to unmarshal READY guilds: %s", err)
+			return false
+		}
+		// Shards warming up during resharding are not a part of the session yet
+		if shard.dispatching.Load() {
+			s.notReady()
+		}
+		// Unavailable guilds are replaced here instead of the READY handler, so they are known before
+		// handlers of following GUILD_CREATE events run. Guilds left from the previous session are dropped.
+		var stale []snowflake.ID
+		shard.Unavailable().Each(func(id snowflake.ID, _ ws.UnavailableGuild) {
+			stale = append(stale, id)
+		})
+		for _, id := range stale {
+			shard.Unavailable().Delete(id)
+		}
+		for _, guild := range ready.Guilds {
+			shard.Unavailable().Set(guild.ID, guild)
+		}
+		shard.mut.Lock()
+		defer shard.mut.Unlock()
+		r := &shard.readiness
+		r.generation++
+		r.ready = false
+		r.guilds = len(ready.Guilds)
+		r.pending = make(map[snowflake.ID]struct{}, len(ready.Guilds))
+		r.lazy = make(map[snowflake.ID]struct{}, len(ready.Guilds))
+		for _, guild := range ready.Guilds {
+			r.pending[guild.ID] = struct{}{}
+			r.lazy[guild.ID] = struct{}{}
+		}
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		if len(r.pending) == 0 {
+			return true
+		}
+		generation := r.generation
+		r.timer = time.AfterFunc(s.readyTimeout, func() {
+			shard.mut.Lock()
+			if r.generation != generation || r.ready {
+				shard.mut.Unlock()
+				return
+			}
+			missing := len(r.pending)
+			shard.mut.Unlock()
+			s.log.Warn().Param("shard", shard.ID()).Param("missing", missing).Send("Guilds were not received in time, shard is considered fully ready")
+			s.completeReadiness(shard)
+		})
+		return false
+	case "GUILD_CREATE", "GUILD_DELETE":
+		shard.mut.Lock()
+		defer shard.mut.Unlock()
+		r := &shard.readiness
+		if r.ready || len(r.pending) == 0 {
+			return false
+		}
+		var guild struct {
+			ID snowflake.ID `json:"id"`
+		}
+		if err := json.Unmarshal(ev.Data, &guild); err != nil {
+			return false
+		}
+		if _, ok := r.pending[guild.ID]; !ok {
+			return false
+		}
+		delete(r.pending, guild.ID)
+		return len(r.pending) == 0
+	}
+	return false
+}
+
+// completeReadiness marks the shard as fully ready and reports it. All shards ready are reported as well.
+func (s *sessionImpl) completeReadiness(shard *shardImpl) {
+	shard.mut.Lock()
+	r := &shard.readiness
+	if r.ready {
+		shard.mut.Unlock()
+		return
+	}
+	r.ready = true
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	guilds, missing := r.guilds, len(r.pending)
+	// Guilds received after the timeout are treated as back after an outage
+	for id := range r.pending {
+		delete(r.lazy, id)
+	}
+	clear(r.pending)
+	shard.mut.Unlock()
+
+	// Shards warming up during resharding are not a part of the session yet
+	if !shard.dispatching.Load() {
+		return
+	}
+	s.log.Debug().Param("shard", shard.ID()).Param("guilds", guilds).Send("Shard is fully ready")
+	s.events.ShardFullyReady().Send(shard.ID(), func(handler events.ShardFullyReadyEvent) {
+		handler(shard.ID(), guilds, missing)
+	})
+	s.checkReady()
+}
+
+// notReady resets the session readiness after a shard received a new READY.
+func (s *sessionImpl) notReady() {
+	s.readyMut.Lock()
+	defer s.readyMut.Unlock()
+	if s.allReady {
+		s.allReady = false
+		s.readyCh = make(chan struct{})
+	}
+}
+
+// checkReady reports all shards ready, if every shard of the session is fully ready. It has to be called
+// after shards of the session are changed.
+func (s *sessionImpl) checkReady() {
+	s.mut.RLock()
+	shards := make([]uint16, 0, len(s.shards))
+	for _, shard := range s.shards {
+		if !shard.(*shardImpl).fullyReady() {
+			s.mut.RUnlock()
+			return
+		}
+		shards = append(shards, shard.ID())
+	}
+	s.mut.RUnlock()
+	s.readyMut.Lock()
+	if s.allReady {
+		s.readyMut.Unlock()
+		return
+	}
+	s.allReady = true
+	close(s.readyCh)
+	s.readyMut.Unlock()
+	s.log.Info().Param("shards", len(shards)).Send("All shards are ready")
+	s.events.AllShardsReady().Send(shards, func(handler events.AllShardsReadyEvent) {
+		handler(shards)
+	})
+}
+
+func (s *sessionImpl) WaitReady(ctx context.Context) error {
+	s.readyMut.Lock()
+	ch := s.readyCh
+	s.readyMut.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
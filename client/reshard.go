@@ -0,0 +1,415 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+	"github.com/andersfylling/snowflake/v5"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+func (s *sessionImpl) newShard(id, count uint16) *shardImpl {
+	cfg := s.shardConfig
+	// Gateway scopes the logger in place, so every shard needs its own copy
+	cfg.Logger = s.log.Module("gateway")
+	cfg.ID = id
+	cfg.ShardCount = count
+	return newShard(ws.NewGateway(cfg))
+}
+
+func (s *sessionImpl) Reshard(ctx context.Context, count uint16) error {
+	if count == 0 {
+		return fmt.Errorf("shard count must be greater than 0")
+	}
+	if s.replay {
+		return ErrReshardNotSupported
+	}
+	if s.coordinator != nil {
+		return fmt.Errorf("%w: shard count is managed by the cluster coordinator", ErrReshardNotSupported)
+	}
+	s.mut.RLock()
+	all := len(s.shards) == int(s.shardCount)
+	s.mut.RUnlock()
+	if !all {
+		return fmt.Errorf("%w: session does not run all shards", ErrReshardNotSupported)
+	}
+	if !s.resharding.CompareAndSwap(false, true) {
+		return ErrReshardInProgress
+	}
+	defer s.resharding.Store(false)
+
+	log := s.log.Module("reshard")
+	log.Info().Param("count", count).Send("Starting new shards")
+	shards := make([]*shardImpl, count)
+	for id := range count {
+		shards[id] = s.newShard(id, count)
+	}
+	h := newHandover(shards)
+	s.handover.Store(h)
+	if err := s.warmUp(ctx, h, shards); err != nil {
+		log.Error().Throw(fmt.Errorf("resharding failed, keeping the old shards: %w", err))
+		for _, shard := range shards {
+			shard.stop()
+			shard.Disconnect()
+		}
+		h.discard()
+		s.handover.Store(nil)
+		return fmt.Errorf("failed to start new shards: %w", err)
+	}
+
+	// Shards do not dispatch anything while held events are replayed, so they are handled in order
+	h.mut.Lock()
+	s.mut.Lock()
+	old := s.shards
+	for _, shard := range old {
+		shard.(*shardImpl).dispatching.Store(false)
+	}
+	s.shards = make([]Shard, len(shards))
+	for i, shard := range shards {
+		shard.dispatching.Store(true)
+		s.shards[i] = shard
+	}
+	previous := s.shardCount
+	s.shardCount = count
+	s.mut.Unlock()
+	replayed, skipped := s.replayHeld(h, shards)
+	h.mut.Unlock()
+	time.AfterFunc(handoverGrace, func() {
+		s.handover.CompareAndSwap(h, nil)
+	})
+	log.Info().Param("previous", previous).Param("count", count).Param("replayed", replayed).Param("skipped", skipped).
+		Send("Switched to new shards, closing the old ones")
+	s.checkReady()
+
+	for _, shard := range old {
+		shard.(*shardImpl).stop()
+		// Old sessions are useless now, so they are not saved to the session store
+		shard.Disconnect()
+	}
+	return nil
+}
+
+// handoverGrace is how long dispatches handled by the old shards are compared with dispatches of the new shards.
+const handoverGrace = 5 * time.Second
+
+// maxHeldDispatches is the number of dispatches a new shard can hold. Resharding fails when it is exceeded,
+// instead of keeping every dispatch of a long warm-up in memory.
+const maxHeldDispatches = 50_000
+
+type handledDispatch struct {
+	key uint64
+	at  time.Time
+}
+
+// handover is active while new shards warm up during resharding. New shards hold their dispatches received after READY
+// (like GUILD_CREATE of their guilds), which are replayed at the switch. Old shards record dispatches they handle,
+// so the same dispatch held by a new shard is skipped. Only dispatches handled in the last handoverGrace are kept,
+// as both shards receive the same event at about the same time. They are compared after the switch as well,
+// because the new shards could still receive dispatches handled by the old shards a bit earlier. The same event
+// is received by both shards with the same payload, so they are compared by a hash of the event name and payload.
+type handover struct {
+	mut  sync.Mutex
+	seed maphash.Seed
+	held map[*shardImpl][]ws.InternalDispatchEvent
+	// heldKeys counts held dispatches not handled by the old shards, while matched counts the handled ones,
+	// which are skipped at the switch
+	heldKeys map[uint64]int
+	matched  map[uint64]int
+	// handled are times of dispatches handled by the old shards before a new shard received them, in order of handled
+	handled  map[uint64][]time.Time
+	order    []handledDispatch
+	switched bool
+	// overflow is closed when a new shard holds too many dispatches
+	overflow chan struct{}
+}
+
+func newHandover(shards []*shardImpl) *handover {
+	h := &handover{
+		seed:     maphash.MakeSeed(),
+		held:     make(map[*shardImpl][]ws.InternalDispatchEvent, len(shards)),
+		heldKeys: make(map[uint64]int),
+		matched:  make(map[uint64]int),
+		handled:  make(map[uint64][]time.Time),
+		overflow: make(chan struct{}),
+	}
+	for _, shard := range shards {
+		h.held[shard] = nil
+	}
+	return h
+}
+
+func (h *handover) key(ev ws.InternalDispatchEvent) uint64 {
+	var hash maphash.Hash
+	hash.SetSeed(h.seed)
+	_, _ = hash.WriteString(ev.Event)
+	_, _ = hash.Write(ev.Data)
+	return hash.Sum64()
+}
+
+// record marks the dispatch handled by an old shard. Dispatch already held by a new shard is skipped at the switch.
+func (h *handover) record(key uint64, now time.Time) {
+	if h.heldKeys[key] > 0 {
+		h.heldKeys[key]--
+		h.matched[key]++
+		return
+	}
+	h.forget(now)
+	h.handled[key] = append(h.handled[key], now)
+	h.order = append(h.order, handledDispatch{key: key, at: now})
+}
+
+// handledBefore reports whether the dispatch of a new shard was handled by an old shard in the last handoverGrace.
+// The dispatch is matched only once.
+func (h *handover) handledBefore(key uint64, now time.Time) bool {
+	h.forget(now)
+	times := h.handled[key]
+	if len(times) == 0 {
+		return false
+	}
+	if len(times) == 1 {
+		delete(h.handled, key)
+	} else {
+		h.handled[key] = times[1:]
+	}
+	return true
+}
+
+// forget removes dispatches handled by the old shards more than handoverGrace ago.
+func (h *handover) forget(now time.Time) {
+	for len(h.order) > 0 && now.Sub(h.order[0].at) > handoverGrace {
+		first := h.order[0]
+		h.order = h.order[1:]
+		// The dispatch could have been matched already
+		if times := h.handled[first.key]; len(times) > 0 && !times[0].After(first.at) {
+			if len(times) == 1 {
+				delete(h.handled, first.key)
+			} else {
+				h.handled[first.key] = times[1:]
+			}
+		}
+	}
+}
+
+// hold keeps the dispatch of a new shard until the switch.
+func (h *handover) hold(shard *shardImpl, key uint64, data ws.InternalDispatchEvent) {
+	if len(h.held[shard]) >= maxHeldDispatches {
+		data.Dereference()
+		select {
+		case <-h.overflow:
+		default:
+			close(h.overflow)
+		}
+		return
+	}
+	h.held[shard] = append(h.held[shard], data)
+	h.heldKeys[key]++
+}
+
+// discard drops held dispatches after resharding failed.
+func (h *handover) discard() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	for _, held := range h.held {
+		for _, ev := range held {
+			ev.Dereference()
+		}
+	}
+	h.held = nil
+	h.heldKeys = nil
+	h.matched = nil
+	h.handled = nil
+	h.order = nil
+	h.switched = true
+}
+
+// handOver handles the dispatch while the handover is active. Dispatches are handled under the lock of the handover,
+// so none of them is handled by the old shards after the held ones are replayed.
+func (s *sessionImpl) handOver(h *handover, pool golog.Pool, shard *shardImpl, data ws.InternalDispatchEvent, complete bool) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	now := time.Now()
+	if shard.dispatching.Load() {
+		if !h.switched {
+			h.record(h.key(data), now)
+		} else if h.switched && h.handledBefore(h.key(data), now) {
+			// Dispatched by the old shard, which received it first
+			data.Dereference()
+			if complete {
+				s.completeReadiness(shard)
+			}
+			return
+		}
+		s.execute(pool, shard, data, complete)
+		return
+	}
+	if _, ok := h.held[shard]; ok && !h.switched && data.OpCode == 0 {
+		if data.Event == "READY" {
+			data.Dereference()
+		} else if key := h.key(data); h.handledBefore(key, now) {
+			data.Dereference()
+		} else {
+			h.hold(shard, key, data)
+		}
+	} else {
+		data.Dereference()
+	}
+	if complete {
+		s.completeReadiness(shard)
+	}
+}
+
+// replayHeld handles dispatches held by the new shards, which were not handled by the old ones. It has to be called
+// with the lock of the handover held. Dispatches matched before the switch are forgotten then.
+func (s *sessionImpl) replayHeld(h *handover, shards []*shardImpl) (replayed, skipped int) {
+	pool := golog.NewPool(s.log.Module("event-handler"))
+	for _, shard := range shards {
+		for _, ev := range h.held[shard] {
+			if key := h.key(ev); h.matched[key] > 0 {
+				h.matched[key]--
+				ev.Dereference()
+				skipped++
+				continue
+			}
+			s.execute(pool, shard, ev, false)
+			replayed++
+		}
+	}
+	h.held = nil
+	h.heldKeys = nil
+	h.matched = nil
+	h.switched = true
+	return
+}
+
+// warmUp connects new shards and waits until all guilds from their READY events are received.
+// Shards do not dispatch events in the meantime, they are held by the handover instead.
+func (s *sessionImpl) warmUp(ctx context.Context, h *handover, shards []*shardImpl) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	overflow := make(chan struct{})
+	go func() {
+		select {
+		case <-h.overflow:
+			close(overflow)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	wg.Add(len(shards))
+	for i, shard := range shards {
+		s.listen(shard)
+		go func() {
+			defer wg.Done()
+			if errs[i] = s.waitGuilds(ctx, shard); errs[i] != nil {
+				errs[i] = fmt.Errorf("shard #%d: %w", shard.ID(), errs[i])
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-overflow:
+		return fmt.Errorf("new shards hold more than %d dispatches each", maxHeldDispatches)
+	default:
+	}
+	// The first error cancels the other shards, their (context) errors are not interesting
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitGuilds connects the shard and waits for guilds from its READY. Unavailable guilds of the shard are tracked
+// by handleEvents, as for active shards.
+func (s *sessionImpl) waitGuilds(ctx context.Context, shard *shardImpl) error {
+	listener, cancel := shard.Listen(ws.WithEvents("READY", "GUILD_CREATE", "GUILD_DELETE"))
+	defer cancel()
+	if err := shard.Connect(ctx); err != nil {
+		return err
+	}
+	var (
+		ready   bool
+		pending = make(map[snowflake.ID]struct{})
+	)
+	for !ready || len(pending) > 0 {
+		select {
+		case msg, ok := <-listener:
+			if !ok {
+				return fmt.Errorf("shard listener closed")
+			}
+			switch data := msg.(type) {
+			case ws.InternalDispatchEvent:
+				if data.OpCode != 0 {
+					data.Dereference()
+					continue
+				}
+				ready = ready || data.Event == "READY"
+				err := trackGuild(data, pending)
+				data.Dereference()
+				if err != nil {
+					return err
+				}
+			case ws.InternalFatalErrorEvent:
+				return data.Err
+			case ws.InternalReconnectGaveUpEvent:
+				return fmt.Errorf("shard gave up reconnecting: %w", data.Err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func trackGuild(ev ws.InternalDispatchEvent, pending map[snowflake.ID]struct{}) error {
+	switch ev.Event {
+	case "READY":
+		var ready struct {
+			Guilds []ws.UnavailableGuild `json:"guilds"`
+		}
+		if err := json.Unmarshal(ev.Data, &ready); err != nil {
+			return fmt.Errorf("failed to unmarshal ready event: %w", err)
+		}
+		// Shard could have been re-identified, guilds of the previous session are not relevant anymore
+		clear(pending)
+		for _, guild := range ready.Guilds {
+			pending[guild.ID] = struct{}{}
+		}
+	case "GUILD_CREATE", "GUILD_DELETE":
+		ids, ok := ws.PeekIDs(ev.Data, "id")
+		if !ok {
+			return fmt.Errorf("failed to read guild id of %s event", ev.Event)
+		}
+		delete(pending, ids[0])
+	}
+	return nil
+}
+
+// reshardRequired reshards the session after Discord closed the shard with 4011 code.
+func (s *sessionImpl) reshardRequired() {
+	log := s.log.Module("reshard")
+	info, err := s.gatewayInfo.GatewayInfo()
+	if err != nil {
+		s.reportError(fmt.Errorf("failed to fetch recommended shard count: %w", err))
+		return
+	}
+	count := info.Shards
+	if current := s.ShardCount(); count <= current {
+		count = current * 2
+	}
+	log.Warn().Param("count", count).Send("Discord requires more shards, resharding")
+	if err = s.Reshard(context.Background(), count); err != nil && !errors.Is(err, ErrReshardInProgress) {
+		s.reportError(fmt.Errorf("automatic resharding failed: %w", err))
+	}
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/bfcord/ws"
+	"github.com/BOOMfinity/bfcord/ws/wstest"
+)
+
+func TestReshard(t *testing.T) {
+	guilds := testGuilds(4)
+	srv := wstest.NewServer(wstest.WithToken(testToken), wstest.WithGuilds(guilds...))
+	defer srv.Close()
+	sess := startSession(t, srv, newCreator().Concurrency(2))
+
+	var (
+		mut      sync.Mutex
+		received = make(map[string]int)
+		joined   atomic.Int64
+	)
+	sess.Events().MessageCreate().Listen(func(msg *ws.MessageCreateEvent) {
+		mut.Lock()
+		received[msg.Content]++
+		mut.Unlock()
+	})
+	sess.Events().GuildJoin().Listen(func(*ws.GuildCreateEvent) {
+		joined.Add(1)
+	})
+	// Guilds received by the new shards are put back to the cache
+	for _, guild := range guilds {
+		_ = sess.Cache().Guilds().Delete(guild.ID)
+	}
+
+	// Messages are sent to both shards of the guild until the new shards take over
+	var (
+		sent int
+		done = make(chan struct{})
+		stop = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for {
+			guild := guilds[sent%len(guilds)].ID
+			err := srv.DispatchGuild(guild, "MESSAGE_CREATE", map[string]any{
+				"id": strconv.Itoa(sent + 1), "channel_id": "1", "guild_id": guild.String(), "content": strconv.Itoa(sent),
+			})
+			if err != nil {
+				t.Errorf("failed to dispatch message: %s", err)
+				return
+			}
+			sent++
+			select {
+			case <-stop:
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+		}
+	}()
+
+	srv.SetShardCount(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	err := sess.Reshard(ctx, 2)
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatalf("failed to reshard: %s", err)
+	}
+	if count := sess.ShardCount(); count != 2 {
+		t.Fatalf("expected 2 shards, got %d", count)
+	}
+
+	// The last message is handled by the new shards, so all of the previous ones are handled as well
+	last := strconv.Itoa(sent - 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mut.Lock()
+		n := received[last]
+		mut.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mut.Lock()
+	defer mut.Unlock()
+	for i := range sent {
+		if n := received[strconv.Itoa(i)]; n != 1 {
+			t.Errorf("message %d of %d handled %d times", i, sent, n)
+		}
+	}
+	for _, guild := range guilds {
+		if _, err := sess.Cache().Guilds().Get(guild.ID); err != nil {
+			t.Errorf("guild %d is not cached: %s", guild.ID, err)
+		}
+	}
+	if n := joined.Load(); n != 0 {
+		t.Errorf("expected no guild joins, got %d", n)
+	}
+}
+
+func TestHandover(t *testing.T) {
+	shard := &shardImpl{}
+	event := func(data string) ws.InternalDispatchEvent {
+		return &ws.Event{Event: "PRESENCE_UPDATE", Data: []byte(data)}
+	}
+	online, idle := event(`{"status":"online"}`), event(`{"status":"idle"}`)
+	start := time.Now()
+
+	t.Run("forget", func(t *testing.T) {
+		h := newHandover([]*shardImpl{shard})
+		h.record(h.key(online), start)
+		h.record(h.key(idle), start.Add(time.Second))
+		if h.handledBefore(h.key(online), start.Add(handoverGrace+time.Millisecond)) {
+			t.Fatal("dispatch older than the grace period was matched")
+		}
+		if !h.handledBefore(h.key(idle), start.Add(handoverGrace)) {
+			t.Fatal("dispatch within the grace period was not matched")
+		}
+		if len(h.handled) != 0 {
+			t.Fatalf("expected no handled dispatches, got %d", len(h.handled))
+		}
+		h.forget(start.Add(2 * handoverGrace))
+		if len(h.order) != 0 {
+			t.Fatalf("expected no dispatches in order, got %d", len(h.order))
+		}
+	})
+	t.Run("same payload", func(t *testing.T) {
+		h := newHandover([]*shardImpl{shard})
+		// online -> idle -> online is received by both shards
+		h.record(h.key(online), start)
+		h.record(h.key(idle), start)
+		h.record(h.key(online), start)
+		for _, ev := range []ws.InternalDispatchEvent{online, idle, online} {
+			if !h.handledBefore(h.key(ev), start) {
+				t.Fatalf("%s was not matched", ev.Data)
+			}
+		}
+		// Going online again is a new dispatch
+		if h.handledBefore(h.key(online), start) {
+			t.Fatal("new dispatch was matched")
+		}
+	})
+	t.Run("held first", func(t *testing.T) {
+		h := newHandover([]*shardImpl{shard})
+		h.hold(shard, h.key(online), online)
+		h.record(h.key(online), start)
+		h.record(h.key(online), start)
+		if h.matched[h.key(online)] != 1 || len(h.handled) != 1 {
+			t.Fatalf("expected one matched and one handled dispatch, got %d and %d", h.matched[h.key(online)], len(h.handled))
+		}
+	})
+	t.Run("overflow", func(t *testing.T) {
+		h := newHandover([]*shardImpl{shard})
+		for range maxHeldDispatches {
+			h.hold(shard, h.key(online), online)
+		}
+		select {
+		case <-h.overflow:
+			t.Fatal("overflow reported before the limit")
+		default:
+		}
+		h.hold(shard, h.key(idle), &ws.Event{Event: "PRESENCE_UPDATE"})
+		h.hold(shard, h.key(idle), &ws.Event{Event: "PRESENCE_UPDATE"})
+		select {
+		case <-h.overflow:
+		default:
+			t.Fatal("overflow was not reported")
+		}
+		if n := len(h.held[shard]); n != maxHeldDispatches {
+			t.Fatalf("expected %d held dispatches, got %d", maxHeldDispatches, n)
+		}
+	})
+}
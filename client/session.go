@@ -2,8 +2,10 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/BOOMfinity/bfcord/api"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,8 +15,11 @@ import (
 
 	"github.com/BOOMfinity/bfcord/client/cache"
 	"github.com/BOOMfinity/bfcord/client/events"
+	"github.com/BOOMfinity/bfcord/cluster"
 	"github.com/BOOMfinity/bfcord/discord"
+	"github.com/BOOMfinity/bfcord/metrics"
 	"github.com/BOOMfinity/bfcord/utils"
+	"github.com/BOOMfinity/bfcord/voice"
 	"github.com/BOOMfinity/bfcord/ws"
 )
 
@@ -35,35 +40,106 @@ type Session interface {
 	//
 	// If no shard id is provided, then all shards of current Session instance are checked. It is not recommended in most cases.
 	//
-	// If gateway reach the max reconnection limit, it will wait 5 minutes before next try. Of course, you won't receive any new events you have to handle but if you have the interval jobs (or dashboard), you should be sure the specific shard is connected.
+	// If gateway is waiting for the next reconnection attempt (see ws.ReconnectPolicy), it is not alive. Of course, you won't receive any new events you have to handle but if you have the interval jobs (or dashboard), you should be sure the specific shard is connected.
 	Alive(shard ...uint16) bool
 	// Unavailable checks if guild is not available due to outage or has not been loaded from lazy GUILD_CREATE events yet.
 	Unavailable(id snowflake.ID) bool
 	UnavailableCount() int
 	FetchMembers(ctx context.Context, params ws.RequestGuildMembersParams) ([]discord.MemberWithUser, []discord.Presence, error)
+	// UpdatePresence changes the bot presence on the given shards. If no shard id is provided, all shards of current Session instance are updated.
+	UpdatePresence(ctx context.Context, presence ws.PresenceUpdate, shards ...uint16) error
+	// JoinVoice sends voice state update on the shard of the guild and waits for both VOICE_STATE_UPDATE and VOICE_SERVER_UPDATE of the bot user.
+	//
+	// Server updates with null endpoint (voice server reallocation) are skipped until Discord sends a new endpoint.
+	JoinVoice(ctx context.Context, guildID, channelID snowflake.ID, mute, deaf bool) (voice.Credentials, error)
+	// MoveVoice moves the bot to another voice channel of the same guild. If voice server has not changed, previous token and endpoint are returned.
+	MoveVoice(ctx context.Context, guildID, channelID snowflake.ID, mute, deaf bool) (voice.Credentials, error)
+	LeaveVoice(ctx context.Context, guildID snowflake.ID) error
 
 	PermissionsIn(guild, channel, member snowflake.ID) (discord.Permission, error)
 	SortedMemberRoles(guild, member snowflake.ID) ([]discord.Role, error)
 
-	Shutdown()
+	// Errors returns fatal shard errors (like invalid token or disallowed intents) as ShardError. Shard that sent the error
+	// does not reconnect until Connect is called again.
+	Errors() <-chan error
+	// Shutdown stops the session gracefully. Connections of the shards are closed first, so no new dispatches are received,
+	// then dispatches received before are handled and Shutdown waits for running handlers and REST requests until ctx is done.
+	// Finally, the recorder is closed and the session leaves the cluster (if any).
+	//
+	// If session store is configured, shards stay resumable and their sessions are saved (see KeepResumable).
+	// Returned error joins everything that failed or did not finish in time.
+	Shutdown(ctx context.Context, opts ...ShutdownOption) error
+	// Start connects all shards of the session and waits until they are connected. Shards identify in max_concurrency
+	// buckets (shard_id % max_concurrency) in the order of their IDs, and progress is reported after every shard
+	// (see Creator.StartupProgress). It panics if a shard fails to start, for example when the session start limit is exhausted.
 	Start()
+	// Reshard connects all shards of the new count in the background and waits until they receive all their guilds.
+	// Then event dispatch is switched to the new shards at once and the old shards are closed. If anything fails
+	// before the switch, new shards are closed and the session keeps running on the old ones.
+	//
+	// Until the switch, events are dispatched by the old shards, while the new ones hold their events (including
+	// GUILD_CREATE of their guilds). Held events are handled at the switch, so the cache is updated with them,
+	// except events already dispatched by the old shards. Resharding fails if a new shard holds more than 50000
+	// events. Only sessions running all shards can be resharded.
+	Reshard(ctx context.Context, count uint16) error
+	// WaitReady waits until all shards of the session are fully ready: every guild from their READY events
+	// is received (or the ready timeout passed, see Creator.ReadyTimeout). It returns immediately if they already are.
+	WaitReady(ctx context.Context) error
+}
+
+// StartupProgress is reported by Session.Start every time a shard connects or fails to connect.
+type StartupProgress struct {
+	Shard uint16
+	// Connected is the number of shards connected so far
+	Connected int
+	Total     int
+	Elapsed   time.Duration
+	Err       error
+	// SessionStarts is the number of session starts left (-1 if it is not tracked, like in a cluster)
+	SessionStarts int
 }
 
 type sessionImpl struct {
 	api.Client
 
-	events      events.SessionDispatcher
-	shards      []Shard
-	shardCount  uint16
-	log         golog.Logger
-	cache       cache.Store
-	handlers    utils.SimpleMap[string, handleDispatchFn]
-	mut         sync.RWMutex
-	unavailable utils.SimpleMap[uint16, utils.SimpleMap[snowflake.ID, ws.UnavailableGuild]]
+	events     events.SessionDispatcher
+	shards     []Shard
+	shardCount uint16
+	log        golog.Logger
+	cache      cache.Store
+	handlers   utils.SimpleMap[string, handleDispatchFn]
+	mut        sync.RWMutex
+	voice      utils.SimpleMap[snowflake.ID, voice.Credentials]
+	errs       chan error
+	recorder   ws.Recorder
+	// shardConfig is the configuration of new shards, without logger, shard id and count
+	shardConfig ws.Config
+	gatewayInfo GatewayInfoSource
+	replay      bool
+	autoReshard bool
+	resharding  atomic.Bool
+	// handover is set while new shards warm up, see Session.Reshard
+	handover    atomic.Pointer[handover]
+	coordinator cluster.Coordinator
+	// stopping is set by Shutdown, leases are not applied anymore
+	stopping atomic.Bool
+	// loops and running count handleEvents loops and dispatch handlers in progress, they are awaited by Shutdown
+	loops    atomic.Int64
+	running  atomic.Int64
+	executor Executor
+	// identify is nil when identifies are limited by the cluster coordinator
+	identify *ws.IdentifyScheduler
+	progress func(p StartupProgress)
+	// readyCh is closed when all shards are fully ready, it is replaced when any of them receives a new READY
+	readyTimeout time.Duration
+	readyMut     sync.Mutex
+	readyCh      chan struct{}
+	allReady     bool
 
 	metrics struct {
 		events    atomic.Uint64
 		totalTime atomic.Uint64
+		duration  metrics.Histogram
 	}
 }
 
@@ -80,9 +156,11 @@ func (s *sessionImpl) SortedMemberRoles(guild, member snowflake.ID) ([]discord.R
 }
 
 func (s *sessionImpl) UnavailableCount() (c int) {
-	s.unavailable.Each(func(_ uint16, v utils.SimpleMap[snowflake.ID, ws.UnavailableGuild]) {
-		c += v.Size()
-	})
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	for _, shard := range s.shards {
+		c += shard.Unavailable().Size()
+	}
 	return
 }
 
@@ -130,6 +208,24 @@ func (s *sessionImpl) FetchMembers(ctx context.Context, params ws.RequestGuildMe
 	return members, presences, err
 }
 
+func (s *sessionImpl) UpdatePresence(ctx context.Context, presence ws.PresenceUpdate, shards ...uint16) error {
+	if len(shards) == 0 {
+		shards = s.Shards()
+	}
+	var errs []error
+	for _, id := range shards {
+		shard := s.Get(id)
+		if shard == nil {
+			errs = append(errs, fmt.Errorf("shard #%d is not managed by this session", id))
+			continue
+		}
+		if err := shard.UpdatePresence(ctx, presence); err != nil {
+			errs = append(errs, fmt.Errorf("shard #%d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (s *sessionImpl) Alive(shard ...uint16) bool {
 	if len(shard) == 0 {
 		shard = s.Shards()
@@ -143,13 +239,12 @@ func (s *sessionImpl) Alive(shard ...uint16) bool {
 }
 
 func (s *sessionImpl) Unavailable(id snowflake.ID) bool {
-	shard := s.ShardID(id)
-	if data, ok := s.unavailable.Get(shard); ok {
-		if _, ok = data.Get(id); ok {
-			return true
-		}
+	shard := s.Get(s.ShardID(id))
+	if shard == nil {
+		return false
 	}
-	return false
+	_, ok := shard.Unavailable().Get(id)
+	return ok
 }
 
 func (s *sessionImpl) Events() events.SessionDispatcher {
@@ -165,17 +260,21 @@ func (s *sessionImpl) Log() golog.Logger {
 }
 
 func (s *sessionImpl) ShardID(guild snowflake.ID) uint16 {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
 	return uint16(guild>>22) % s.shardCount
 }
 
 func (s *sessionImpl) ShardCount() uint16 {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
 	return s.shardCount
 }
 
 func (s *sessionImpl) Shards() (shards []uint16) {
 	s.mut.RLock()
 	defer s.mut.RUnlock()
-	shards = make([]uint16, len(s.shards))
+	shards = make([]uint16, 0, len(s.shards))
 	for _, shard := range s.shards {
 		shards = append(shards, shard.ID())
 	}
@@ -196,6 +295,9 @@ func (s *sessionImpl) Get(id uint16) Shard {
 func (s *sessionImpl) Ping() (avg int) {
 	s.mut.RLock()
 	defer s.mut.RUnlock()
+	if len(s.shards) == 0 {
+		return 0
+	}
 	for _, shard := range s.shards {
 		avg += shard.Ping()
 	}
@@ -203,11 +305,26 @@ func (s *sessionImpl) Ping() (avg int) {
 	return
 }
 
-func (s *sessionImpl) Shutdown() {
-	s.mut.RLock()
-	defer s.mut.RUnlock()
-	for _, shard := range s.shards {
+func (s *sessionImpl) Errors() <-chan error {
+	return s.errs
+}
+
+func (s *sessionImpl) reportError(err error) {
+	select {
+	case s.errs <- err:
+	default:
+		s.log.Warn().Throw(fmt.Errorf("error channel is full, dropping error: %w", err))
+	}
+}
+
+// closeShard closes the connection of the shard. Its session is saved if session store is configured.
+func (s *sessionImpl) closeShard(shard Shard) {
+	if shard.Config().SessionStore == nil {
 		shard.Disconnect()
+		return
+	}
+	if err := shard.Close(); err != nil {
+		s.log.Error().Param("shard", shard.Config().ID).Throw(err)
 	}
 }
 
@@ -244,7 +361,7 @@ func (s *sessionImpl) registerEventHandlers() {
 	s.handlers.Set("INVITE_CREATE", inviteCreateEventHandler)
 	s.handlers.Set("INVITE_DELETE", inviteDeleteEventHandler)
 	s.handlers.Set("INTERACTION_CREATE", handle[discord.Interaction](func(log golog.Logger, sess Session, _ ws.InternalDispatchEvent, _ Shard, data *discord.Interaction) {
-		sess.Events().InteractionCreate().Sender(func(handler events.InteractionCreateEvent) {
+		sess.Events().InteractionCreate().Send(data, func(handler events.InteractionCreateEvent) {
 			handler(data, sess.Interaction(data.ID, data.Token))
 		})
 	}))
@@ -254,21 +371,65 @@ func (s *sessionImpl) registerEventHandlers() {
 
 func (s *sessionImpl) Start() {
 	go s.metricsService()
+	// Shards of the same bucket identify in the order of their IDs. The lock is not held while they connect,
+	// as resharding (like after 4011 close code) replaces them under the write lock.
 	s.mut.RLock()
-	defer s.mut.RUnlock()
-	var wg sync.WaitGroup
-	wg.Add(len(s.shards))
-	for _, shard := range s.shards {
+	shards := slices.SortedFunc(slices.Values(s.shards), func(a, b Shard) int {
+		return int(a.ID()) - int(b.ID())
+	})
+	s.mut.RUnlock()
+	var (
+		wg        sync.WaitGroup
+		started   = time.Now()
+		connected atomic.Int64
+	)
+	wg.Add(len(shards))
+	for _, shard := range shards {
 		go func() {
-			go s.handleEvents(shard)
+			s.listen(shard.(*shardImpl))
 			defer wg.Done()
-			if err := shard.Connect(context.Background()); err != nil {
+			err := shard.Connect(context.Background())
+			if err == nil {
+				connected.Add(1)
+			}
+			s.reportProgress(shard.ID(), int(connected.Load()), len(shards), time.Since(started), err)
+			if err != nil {
+				if s.autoReshard && errors.Is(err, ws.ErrCloseShardingRequired) {
+					s.log.Warn().Param("shard", shard.ID()).Send("Discord requires more shards")
+					go s.reshardRequired()
+					return
+				}
 				panic(fmt.Errorf("failed to start shard #%d: %w", shard.ID(), err))
 			}
 		}()
 		time.Sleep(150 * time.Millisecond)
 	}
 	wg.Wait()
+	// Session without shards (like a cluster process without a lease) is ready at once
+	s.checkReady()
+	if s.coordinator != nil {
+		go s.followLeases()
+	}
+}
+
+func (s *sessionImpl) reportProgress(shard uint16, connected, total int, elapsed time.Duration, err error) {
+	p := StartupProgress{
+		Shard:         shard,
+		Connected:     connected,
+		Total:         total,
+		Elapsed:       elapsed,
+		Err:           err,
+		SessionStarts: -1,
+	}
+	if s.identify != nil {
+		p.SessionStarts, _ = s.identify.Remaining()
+	}
+	if err == nil {
+		s.log.Info().Param("shard", shard).Param("elapsed", elapsed.Round(time.Millisecond)).Send("Shard connected (%d/%d)", connected, total)
+	}
+	if s.progress != nil {
+		s.progress(p)
+	}
 }
 
 func New() Creator {
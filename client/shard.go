@@ -1,7 +1,9 @@
 package client
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BOOMfinity/bfcord/utils"
@@ -18,16 +20,48 @@ type Shard interface {
 	Unavailable() utils.SimpleMap[snowflake.ID, ws.UnavailableGuild]
 }
 
+// ShardError is sent to Session.Errors when the shard stops because of a fatal error.
+type ShardError struct {
+	Shard uint16
+	Err   error
+}
+
+func (e ShardError) Error() string {
+	return fmt.Sprintf("shard #%d: %s", e.Shard, e.Err)
+}
+
+func (e ShardError) Unwrap() error {
+	return e.Err
+}
+
 type shardImpl struct {
 	ws.Gateway
 
 	ping        int
 	history     []int
 	unavailable utils.SimpleMap[snowflake.ID, ws.UnavailableGuild]
+	// dispatching is false while the shard is not (or no longer) a part of the session, see Session.Reshard
+	dispatching atomic.Bool
+	done        chan struct{}
+	stopOnce    sync.Once
+	// resuming is set between StatusResuming and StatusConnected, it is used only by handleEvents
+	resuming  bool
+	readiness readiness
+	// lifecycle are shard events waiting for their listeners, see sessionImpl.notify
+	lifecycle    []func()
+	notifying    bool
+	lifecycleMut sync.Mutex
 
 	mut sync.Mutex
 }
 
+// stop ends background goroutines of the shard. It does not close the connection.
+func (s *shardImpl) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
 func (s *shardImpl) Unavailable() utils.SimpleMap[snowflake.ID, ws.UnavailableGuild] {
 	return s.unavailable
 }
@@ -36,7 +70,17 @@ func (s *shardImpl) backgroundJob() {
 	log := s.Log().Module("background")
 	listener, cancel := s.Listen()
 	defer cancel()
-	for msg := range listener {
+	for {
+		var msg any
+		select {
+		case m, ok := <-listener:
+			if !ok {
+				return
+			}
+			msg = m
+		case <-s.done:
+			return
+		}
 		switch data := msg.(type) {
 		case ws.InternalHeartbeatEvent:
 			s.mut.Lock()
@@ -50,6 +94,17 @@ func (s *shardImpl) backgroundJob() {
 	}
 }
 
+func newShard(gateway ws.Gateway) *shardImpl {
+	shard := &shardImpl{
+		Gateway:     gateway,
+		ping:        -1,
+		unavailable: utils.NewSimpleMap[snowflake.ID, ws.UnavailableGuild](),
+		done:        make(chan struct{}),
+	}
+	go shard.backgroundJob()
+	return shard
+}
+
 func (s *shardImpl) ID() uint16 {
 	return s.Config().ID
 }
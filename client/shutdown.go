@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// drainInterval is how often Shutdown checks running handlers.
+const drainInterval = 10 * time.Millisecond
+
+type shutdownOptions struct {
+	resumable bool
+}
+
+type ShutdownOption func(o *shutdownOptions)
+
+// KeepResumable decides whether shards close their connections with a resumable close code and save their sessions
+// to the session store. By default, sessions are kept resumable only if the session store is configured.
+func KeepResumable(keep bool) ShutdownOption {
+	return func(o *shutdownOptions) {
+		o.resumable = keep
+	}
+}
+
+func (s *sessionImpl) Shutdown(ctx context.Context, opts ...ShutdownOption) error {
+	if !s.stopping.CompareAndSwap(false, true) {
+		return ErrShutdown
+	}
+	o := shutdownOptions{resumable: s.shardConfig.SessionStore != nil}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	log := s.log.Module("shutdown")
+	started := time.Now()
+	s.mut.RLock()
+	shards := slices.Clone(s.shards)
+	s.mut.RUnlock()
+	log.Info().Param("shards", len(shards)).Param("resumable", o.resumable).Send("Shutting down the session")
+
+	var errs []error
+	// Connections are closed first, so the saved sequence covers every dispatch handled below
+	for _, shard := range shards {
+		if !o.resumable {
+			shard.Disconnect()
+			continue
+		}
+		if err := shard.Close(); err != nil {
+			errs = append(errs, ShardError{Shard: shard.ID(), Err: err})
+		}
+	}
+	for _, shard := range shards {
+		shard.(*shardImpl).stop()
+	}
+	loopsErr := waitIdle(ctx, &s.loops)
+	if loopsErr != nil {
+		errs = append(errs, fmt.Errorf("%d shard(s) did not handle received events: %w", s.loops.Load(), loopsErr))
+	}
+	if err := waitIdle(ctx, &s.running); err != nil {
+		errs = append(errs, fmt.Errorf("%d handler(s) still running: %w", s.running.Load(), err))
+	} else if loopsErr == nil {
+		// Closing waits for workers, so it is skipped when handlers are stuck or shards still execute dispatches
+		s.executor.Close()
+	}
+	if err := s.Drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if s.recorder != nil {
+		if err := s.recorder.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close recorder: %w", err))
+		}
+	}
+	// Shards are closed first, so they are not resumed by another process before their sessions are saved
+	if s.coordinator != nil {
+		if err := s.coordinator.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to leave the cluster: %w", err))
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		log.Error().Param("elapsed", time.Since(started).Round(time.Millisecond)).Throw(fmt.Errorf("session did not shut down cleanly: %w", err))
+		return err
+	}
+	log.Info().Param("elapsed", time.Since(started).Round(time.Millisecond)).Send("Session shut down")
+	return nil
+}
+
+// waitIdle waits until counter drops to zero or ctx is done.
+func waitIdle(ctx context.Context, counter *atomic.Int64) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for counter.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
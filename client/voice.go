@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andersfylling/snowflake/v5"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/voice"
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+const (
+	voiceTimeout = 15 * time.Second
+	// voiceServerGrace is how long MoveVoice waits for VOICE_SERVER_UPDATE, which is sent only if the voice server has changed.
+	voiceServerGrace = 3 * time.Second
+)
+
+func (s *sessionImpl) JoinVoice(ctx context.Context, guildID, channelID snowflake.ID, mute, deaf bool) (voice.Credentials, error) {
+	return s.updateVoiceState(ctx, ws.UpdateVoiceStateParams{
+		GuildID:   guildID,
+		ChannelID: &channelID,
+		SelfMute:  mute,
+		SelfDeaf:  deaf,
+	}, true)
+}
+
+func (s *sessionImpl) MoveVoice(ctx context.Context, guildID, channelID snowflake.ID, mute, deaf bool) (voice.Credentials, error) {
+	return s.updateVoiceState(ctx, ws.UpdateVoiceStateParams{
+		GuildID:   guildID,
+		ChannelID: &channelID,
+		SelfMute:  mute,
+		SelfDeaf:  deaf,
+	}, false)
+}
+
+func (s *sessionImpl) LeaveVoice(ctx context.Context, guildID snowflake.ID) error {
+	_, err := s.updateVoiceState(ctx, ws.UpdateVoiceStateParams{
+		GuildID: guildID,
+	}, false)
+	s.voice.Delete(guildID)
+	return err
+}
+
+// updateVoiceState sends opcode 4 and waits for the VOICE_STATE_UPDATE of the bot user.
+// If requireServer is true, it also waits for VOICE_SERVER_UPDATE with an endpoint.
+func (s *sessionImpl) updateVoiceState(ctx context.Context, params ws.UpdateVoiceStateParams, requireServer bool) (creds voice.Credentials, err error) {
+	shard := s.Get(s.ShardID(params.GuildID))
+	if shard == nil {
+		return creds, fmt.Errorf("shard #%d is not managed by this session", s.ShardID(params.GuildID))
+	}
+	user, err := s.GetCurrentUser()
+	if err != nil {
+		return creds, fmt.Errorf("failed to get current user: %w", err)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, voiceTimeout)
+		defer cancel()
+	}
+	var channelID snowflake.ID
+	if params.ChannelID != nil {
+		channelID = *params.ChannelID
+	}
+	leaving := params.ChannelID == nil
+
+	creds, _ = s.voice.Get(params.GuildID)
+	creds.GuildID = params.GuildID
+	creds.UserID = user.ID
+
+	events, cancel := shard.Listen(ws.WithEvents("VOICE_STATE_UPDATE", "VOICE_SERVER_UPDATE"))
+	defer cancel()
+	if err = shard.UpdateVoiceState(ctx, params); err != nil {
+		return creds, err
+	}
+
+	var (
+		stateReceived  bool
+		serverReceived bool
+		grace          <-chan time.Time
+	)
+	for {
+		if stateReceived && (serverReceived || leaving) {
+			break
+		}
+		if stateReceived && !requireServer && grace == nil {
+			timer := time.NewTimer(voiceServerGrace)
+			defer timer.Stop()
+			grace = timer.C
+		}
+		select {
+		case msg, ok := <-events:
+			if !ok {
+				return creds, ws.ErrGatewayNotConnected
+			}
+			ev, ok := msg.(ws.InternalDispatchEvent)
+			if !ok {
+				continue
+			}
+			name := ev.Event
+			switch name {
+			case "VOICE_STATE_UPDATE":
+				var state voice.StateUpdateEvent
+				err = json.Unmarshal(ev.Data, &state)
+				if err == nil && state.GuildID == params.GuildID && state.UserID == user.ID && state.ChannelID == channelID {
+					creds.SessionID = state.SessionID
+					creds.ChannelID = state.ChannelID
+					stateReceived = true
+				}
+			case "VOICE_SERVER_UPDATE":
+				var server voice.ServerUpdateEvent
+				err = json.Unmarshal(ev.Data, &server)
+				if err == nil && server.GuildID == params.GuildID {
+					if server.Reallocating() {
+						s.log.Debug().Param("guild", params.GuildID).Send("Voice server is being reallocated, waiting for a new endpoint")
+						break
+					}
+					creds.Token = server.Token
+					creds.Endpoint = server.Endpoint
+					serverReceived = true
+				}
+			}
+			if err != nil && !isVoiceTarget(ev, params.GuildID, user.ID) {
+				// Events of other guilds and users do not matter
+				err = nil
+			}
+			ev.Dereference()
+			if err != nil {
+				return creds, fmt.Errorf("failed to unmarshal %s event: %w", name, err)
+			}
+		case <-grace:
+			if creds.Endpoint == "" {
+				return creds, fmt.Errorf("voice server of guild %d is unknown, use JoinVoice instead", params.GuildID)
+			}
+			serverReceived = true
+		case <-ctx.Done():
+			return creds, fmt.Errorf("could not wait longer for voice state update: %w", ctx.Err())
+		}
+	}
+	if !leaving {
+		s.voice.Set(params.GuildID, creds)
+	}
+	return creds, nil
+}
+
+// isVoiceTarget reports whether the voice event (which failed to decode) is the one updateVoiceState waits for:
+// VOICE_SERVER_UPDATE of the guild or VOICE_STATE_UPDATE of the bot user in the guild. Events without readable IDs
+// are not.
+func isVoiceTarget(ev ws.InternalDispatchEvent, guild, user snowflake.ID) bool {
+	ids, ok := ws.PeekIDs(ev.Data, "guild_id", "user_id")
+	if !ok {
+		return false
+	}
+	return ids[0] == guild && (ev.Event == "VOICE_SERVER_UPDATE" || ids[1] == user)
+}
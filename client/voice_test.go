@@ -0,0 +1,31 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+func TestIsVoiceTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		data     string
+		expected bool
+	}{
+		{name: "bot state", event: "VOICE_STATE_UPDATE", data: `{"guild_id":"1","user_id":"10","channel_id":5}`, expected: true},
+		{name: "other user", event: "VOICE_STATE_UPDATE", data: `{"guild_id":"1","user_id":"11","channel_id":5}`, expected: false},
+		{name: "other guild", event: "VOICE_STATE_UPDATE", data: `{"guild_id":"2","user_id":"10","channel_id":5}`, expected: false},
+		{name: "server", event: "VOICE_SERVER_UPDATE", data: `{"guild_id":"1","token":5}`, expected: true},
+		{name: "other server", event: "VOICE_SERVER_UPDATE", data: `{"guild_id":"2","token":5}`, expected: false},
+		{name: "unreadable", event: "VOICE_SERVER_UPDATE", data: `[1,2]`, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ev := &ws.Event{Event: test.event, Data: []byte(test.data)}
+			if target := isVoiceTarget(ev, 1, 10); target != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, target)
+			}
+		})
+	}
+}
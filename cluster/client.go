@@ -0,0 +1,222 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+var (
+	ErrClosed        = errors.New("connection to the coordinator is closed")
+	ErrAlreadyJoined = errors.New("process has already joined the cluster")
+)
+
+type ClientOption func(c *Client)
+
+// WithName sets the name of the process shown in coordinator logs. Hostname and pid are used by default.
+func WithName(name string) ClientOption {
+	return func(c *Client) {
+		c.name = name
+	}
+}
+
+func WithClientLogger(log golog.Logger) ClientOption {
+	return func(c *Client) {
+		c.log = log
+	}
+}
+
+// Client is a process connected to Server. It implements Coordinator.
+type Client struct {
+	conn   net.Conn
+	name   string
+	log    golog.Logger
+	enc    *json.Encoder
+	wmut   sync.Mutex
+	leases chan Lease
+	done   chan struct{}
+	once   sync.Once
+
+	mut     sync.Mutex
+	joined  bool
+	latest  uint64
+	nextID  uint64
+	pending map[uint64]chan message
+}
+
+func (c *Client) send(msg message) error {
+	c.wmut.Lock()
+	defer c.wmut.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(peerTimeout))
+	if err := c.enc.Encode(msg); err != nil {
+		return fmt.Errorf("failed to send %s message: %w", msg.Type, err)
+	}
+	return nil
+}
+
+func (c *Client) Join(ctx context.Context) (Lease, error) {
+	c.mut.Lock()
+	if c.joined {
+		c.mut.Unlock()
+		return Lease{}, ErrAlreadyJoined
+	}
+	c.joined = true
+	c.mut.Unlock()
+	go c.readLoop()
+	if err := c.send(message{Type: messageJoin, Name: c.name}); err != nil {
+		return Lease{}, err
+	}
+	go c.pingLoop()
+	select {
+	case lease, ok := <-c.leases:
+		if !ok {
+			return Lease{}, ErrClosed
+		}
+		c.log.Info().Param("shards", lease.Shards).Param("count", lease.ShardCount).Send("Joined the cluster")
+		return lease, nil
+	case <-ctx.Done():
+		return Lease{}, ctx.Err()
+	}
+}
+
+func (c *Client) Leases() <-chan Lease {
+	return c.leases
+}
+
+func (c *Client) Ack(lease Lease) error {
+	return c.send(message{Type: messageAck, Generation: lease.Generation})
+}
+
+func (c *Client) Identify(ctx context.Context, shard uint16) error {
+	granted := make(chan message, 1)
+	c.mut.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = granted
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.pending, id)
+		c.mut.Unlock()
+	}()
+	if err := c.send(message{Type: messageIdentify, ID: id, Shard: shard}); err != nil {
+		return err
+	}
+	select {
+	case msg := <-granted:
+		if msg.Denied {
+			return fmt.Errorf("%w: resets in %s", ws.ErrSessionStartLimit, (time.Duration(msg.ResetAfter) * time.Millisecond).Round(time.Second))
+		}
+		return nil
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		// Session start reserved for the identify is given back
+		if err := c.send(message{Type: messageCancel, ID: id}); err != nil {
+			c.log.Warn().Throw(err)
+		}
+		return ctx.Err()
+	}
+}
+
+func (c *Client) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *Client) readLoop() {
+	defer close(c.leases)
+	defer c.Close()
+	r := bufio.NewReader(c.conn)
+	for {
+		msg, err := readMessage(c.conn, r)
+		if err != nil {
+			select {
+			case <-c.done:
+			default:
+				c.log.Error().Throw(fmt.Errorf("lost connection to the coordinator: %w", err))
+			}
+			return
+		}
+		switch msg.Type {
+		case messageLease:
+			c.lease(Lease{Generation: msg.Generation, ShardCount: msg.ShardCount, Shards: msg.Shards})
+		case messageIdentify:
+			c.mut.Lock()
+			if granted, ok := c.pending[msg.ID]; ok {
+				granted <- msg
+				delete(c.pending, msg.ID)
+			}
+			c.mut.Unlock()
+		case messagePong:
+		}
+	}
+}
+
+// lease replaces the lease waiting in the channel, as only the newest one matters.
+func (c *Client) lease(lease Lease) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if lease.Generation < c.latest {
+		return
+	}
+	c.latest = lease.Generation
+	select {
+	case <-c.leases:
+	default:
+	}
+	c.leases <- lease
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.send(message{Type: messagePing}); err != nil {
+				c.log.Warn().Throw(err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Dial connects the process to the coordinator listening on the address ("tcp" or "unix" network).
+// Join has to be called to receive shards.
+func Dial(ctx context.Context, network, address string, opts ...ClientOption) (*Client, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the coordinator: %w", err)
+	}
+	c := &Client{
+		conn:    conn,
+		log:     golog.New("cluster"),
+		enc:     json.NewEncoder(conn),
+		leases:  make(chan Lease, 1),
+		done:    make(chan struct{}),
+		pending: make(map[uint64]chan message),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		c.name = fmt.Sprintf("%s/%d", hostname, os.Getpid())
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
@@ -0,0 +1,139 @@
+// Package cluster splits shards between processes of a bot. Processes join the coordinator, which leases them
+// shard ranges, moves shards of dead processes to the living ones and shares the identify budget of the bot.
+//
+// Server is the reference coordinator reachable over TCP or Unix socket, Dial connects a process to it.
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+const (
+	pingInterval = 5 * time.Second
+	// peerTimeout is the time without any message after which the other side is considered dead
+	peerTimeout = 3 * pingInterval
+)
+
+// Lease is the set of shards assigned to the process.
+type Lease struct {
+	Generation uint64
+	ShardCount uint16
+	Shards     []uint16
+}
+
+// Has reports whether the lease contains the shard.
+func (l Lease) Has(shard uint16) bool {
+	return slices.Contains(l.Shards, shard)
+}
+
+// Coordinator assigns shards to processes of the cluster and shares the identify concurrency between them.
+type Coordinator interface {
+	// Join registers the process in the cluster and waits for its first lease.
+	Join(ctx context.Context) (Lease, error)
+	// Leases returns the following leases of the process. If the process is slow to apply them, only the newest
+	// one is kept. Channel is closed when connection to the coordinator is lost.
+	Leases() <-chan Lease
+	// Ack confirms that shards removed by the lease are closed, so they can be given to other processes.
+	Ack(lease Lease) error
+	// Identify waits until the shard can identify without exceeding max_concurrency and the session start limit
+	// of the bot. It returns ws.ErrSessionStartLimit if the limit is exhausted.
+	Identify(ctx context.Context, shard uint16) error
+	// Close leaves the cluster. Shards of the process are given to other processes.
+	Close() error
+}
+
+type messageType string
+
+const (
+	messageJoin     messageType = "join"
+	messageLease    messageType = "lease"
+	messageAck      messageType = "ack"
+	messageIdentify messageType = "identify"
+	messageCancel   messageType = "cancel"
+	messagePing     messageType = "ping"
+	messagePong     messageType = "pong"
+)
+
+// message is a single line of the protocol (JSON per line) used by both sides.
+type message struct {
+	Type       messageType `json:"type"`
+	ID         uint64      `json:"id,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Shard      uint16      `json:"shard,omitempty"`
+	Generation uint64      `json:"generation,omitempty"`
+	ShardCount uint16      `json:"shard_count,omitempty"`
+	Shards     []uint16    `json:"shards,omitempty"`
+	// Denied identify is answered with the time (in milliseconds) until the session start limit is reset
+	Denied     bool  `json:"denied,omitempty"`
+	ResetAfter int64 `json:"reset_after,omitempty"`
+}
+
+// readMessage reads the next message. The other side is considered dead if nothing is received within peerTimeout.
+func readMessage(conn net.Conn, r *bufio.Reader) (msg message, err error) {
+	_ = conn.SetReadDeadline(time.Now().Add(peerTimeout))
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return msg, err
+	}
+	if err = json.Unmarshal(line, &msg); err != nil {
+		return msg, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return msg, nil
+}
+
+// balance assigns shards to processes, keeping the current assignment of every process as much as possible.
+// Every process gets count/processes shards, processes keeping the most shards get one more first if shards cannot
+// be divided equally. Shards without a process are given in order, so the first assignment is split
+// into contiguous ranges.
+func balance(count uint16, current [][]uint16) [][]uint16 {
+	target := make([][]uint16, len(current))
+	if len(current) == 0 {
+		return target
+	}
+	size, rest := int(count)/len(current), int(count)%len(current)
+	order := make([]int, len(current))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return len(current[b]) - len(current[a])
+	})
+	limits := make([]int, len(current))
+	for rank, i := range order {
+		limits[i] = size
+		if rank < rest {
+			limits[i]++
+		}
+	}
+	taken := make([]bool, count)
+	for i, shards := range current {
+		for _, shard := range slices.Sorted(slices.Values(shards)) {
+			if len(target[i]) == limits[i] {
+				break
+			}
+			if shard < count && !taken[shard] {
+				taken[shard] = true
+				target[i] = append(target[i], shard)
+			}
+		}
+	}
+	var next uint16
+	for i := range target {
+		for len(target[i]) < limits[i] {
+			for taken[next] {
+				next++
+			}
+			taken[next] = true
+			target[i] = append(target[i], next)
+		}
+		slices.Sort(target[i])
+	}
+	return target
+}
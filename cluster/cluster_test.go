@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    uint16
+		current  [][]uint16
+		expected [][]uint16
+	}{
+		{name: "no processes", count: 4, current: [][]uint16{}, expected: [][]uint16{}},
+		{name: "first process", count: 4, current: [][]uint16{nil}, expected: [][]uint16{{0, 1, 2, 3}}},
+		{name: "contiguous ranges", count: 5, current: [][]uint16{nil, nil}, expected: [][]uint16{{0, 1, 2}, {3, 4}}},
+		{name: "more processes than shards", count: 2, current: [][]uint16{nil, nil, nil}, expected: [][]uint16{{0}, {1}, {}}},
+		{name: "process joined", count: 6,
+			current:  [][]uint16{{0, 1, 2}, {3, 4, 5}, nil},
+			expected: [][]uint16{{0, 1}, {3, 4}, {2, 5}}},
+		{name: "first process left", count: 6,
+			current:  [][]uint16{{2, 3}, {4, 5}},
+			expected: [][]uint16{{0, 2, 3}, {1, 4, 5}}},
+		{name: "bigger share is kept", count: 5,
+			current:  [][]uint16{{0}, {1, 2, 3, 4}},
+			expected: [][]uint16{{0, 4}, {1, 2, 3}}},
+		{name: "balanced assignment is kept", count: 4,
+			current:  [][]uint16{{1, 3}, {0, 2}},
+			expected: [][]uint16{{1, 3}, {0, 2}}},
+		{name: "shards out of range", count: 2,
+			current:  [][]uint16{{0, 5}, {1}},
+			expected: [][]uint16{{0}, {1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := balance(test.count, test.current)
+			if len(target) != len(test.expected) {
+				t.Fatalf("expected %d processes, got %d", len(test.expected), len(target))
+			}
+			for i := range target {
+				if !slices.Equal(target[i], test.expected[i]) && len(target[i])+len(test.expected[i]) > 0 {
+					t.Errorf("process %d: expected %v, got %v", i, test.expected[i], target[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+type ServerOption func(s *Server)
+
+func WithLogger(log golog.Logger) ServerOption {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithAckTimeout sets how long the server waits for processes to release shards before they are given to other
+// processes anyway.
+func WithAckTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.ackTimeout = timeout
+	}
+}
+
+// WithSessionStartLimit makes the server lease the session start limit of the bot (see GET /gateway/bot)
+// to processes. Identifies exceeding it are denied with ws.ErrSessionStartLimit.
+func WithSessionStartLimit(total, remaining int, resetAfter time.Duration) ServerOption {
+	return func(s *Server) {
+		s.identifyOpts = append(s.identifyOpts, ws.WithSessionStartLimit(total, remaining, resetAfter))
+	}
+}
+
+// WaitForSessionStartReset makes identifies wait for the reset of the session start limit, instead of being denied
+// when it is exhausted.
+func WaitForSessionStartReset() ServerOption {
+	return func(s *Server) {
+		s.identifyOpts = append(s.identifyOpts, ws.WaitForSessionStartReset())
+	}
+}
+
+// memberQueueSize is the number of messages waiting to be written to a process, it is disconnected when exceeded.
+const memberQueueSize = 256
+
+type member struct {
+	id     uint64
+	name   string
+	conn   net.Conn
+	out    chan message
+	done   chan struct{}
+	shards []uint16
+	// target is the assignment the member is moving to
+	target []uint16
+	leased bool
+	// identifies are cancel functions of identifies waiting for their slot
+	identifies map[uint64]context.CancelFunc
+	// awaiting is the generation of the shrunk lease that has not been acknowledged yet
+	awaiting uint64
+}
+
+// send queues the message. Messages are written in order by writeLoop.
+func (m *member) send(msg message) {
+	select {
+	case <-m.done:
+	case m.out <- msg:
+	default:
+		_ = m.conn.Close()
+	}
+}
+
+func (m *member) writeLoop() {
+	enc := json.NewEncoder(m.conn)
+	for {
+		select {
+		case msg := <-m.out:
+			_ = m.conn.SetWriteDeadline(time.Now().Add(peerTimeout))
+			// Write errors close the connection, which is noticed by the read loop
+			if err := enc.Encode(msg); err != nil {
+				_ = m.conn.Close()
+				return
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Server is the cluster coordinator. Shards are split equally between connected processes, at first into contiguous
+// ranges in the order they joined. When processes join or leave, only shards needed to balance them are moved.
+//
+// Shards are moved in two steps: processes losing shards get a smaller lease first, and processes gaining them
+// get theirs after the old owners acknowledge closing the shards (or disconnect, or the ack timeout passes).
+// This way a shard never runs in two processes at once.
+type Server struct {
+	shardCount   uint16
+	log          golog.Logger
+	ackTimeout   time.Duration
+	identifyOpts []ws.IdentifySchedulerOption
+	scheduler    *ws.IdentifyScheduler
+
+	mut        sync.Mutex
+	members    []*member
+	nextID     uint64
+	generation uint64
+	listeners  []net.Listener
+	closed     bool
+}
+
+// ListenAndServe listens on the address ("tcp" or "unix" network) and serves processes until the server is closed.
+func (s *Server) ListenAndServe(network, address string) error {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts processes on the listener until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mut.Lock()
+	if s.closed {
+		s.mut.Unlock()
+		return net.ErrClosed
+	}
+	s.listeners = append(s.listeners, l)
+	s.mut.Unlock()
+	s.log.Info().Param("address", l.Addr()).Send("Coordinator is listening")
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops listening and disconnects all processes.
+func (s *Server) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.closed = true
+	var errs []error
+	for _, l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+	for _, m := range s.members {
+		_ = m.conn.Close()
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	msg, err := readMessage(conn, r)
+	if err != nil || msg.Type != messageJoin {
+		s.log.Warn().Param("address", conn.RemoteAddr()).Send("Connection did not start with join message, closing")
+		return
+	}
+	m := s.join(conn, msg.Name)
+	defer s.leave(m)
+	for {
+		if msg, err = readMessage(conn, r); err != nil {
+			s.log.Debug().Param("process", m.name).Send("Connection lost: %s", err)
+			return
+		}
+		switch msg.Type {
+		case messagePing:
+			m.send(message{Type: messagePong})
+		case messageAck:
+			s.ack(m, msg.Generation)
+		case messageIdentify:
+			s.identify(m, msg.ID, msg.Shard)
+		case messageCancel:
+			s.cancelIdentify(m, msg.ID)
+		default:
+			s.log.Warn().Param("process", m.name).Param("type", msg.Type).Send("Unknown message")
+		}
+	}
+}
+
+func (s *Server) join(conn net.Conn, name string) *member {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.nextID++
+	m := &member{
+		id:   s.nextID,
+		name: name,
+		conn: conn,
+		out:  make(chan message, memberQueueSize),
+		done: make(chan struct{}),
+
+		identifies: make(map[uint64]context.CancelFunc),
+	}
+	go m.writeLoop()
+	if m.name == "" {
+		m.name = conn.RemoteAddr().String()
+	}
+	s.members = append(s.members, m)
+	s.log.Info().Param("process", m.name).Param("processes", len(s.members)).Send("Process joined")
+	s.rebalance()
+	return m
+}
+
+func (s *Server) leave(m *member) {
+	close(m.done)
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	index := slices.Index(s.members, m)
+	if index == -1 {
+		return
+	}
+	s.members = slices.Delete(s.members, index, index+1)
+	// Session starts reserved by the process are given back
+	for _, cancel := range m.identifies {
+		cancel()
+	}
+	s.log.Info().Param("process", m.name).Param("shards", m.shards).Param("processes", len(s.members)).Send("Process left")
+	if !s.closed {
+		s.rebalance()
+	}
+}
+
+// rebalance starts moving shards to the current assignment. It must be called with mut held.
+func (s *Server) rebalance() {
+	s.generation++
+	generation := s.generation
+	current := make([][]uint16, len(s.members))
+	for i, m := range s.members {
+		current[i] = m.target
+	}
+	target := balance(s.shardCount, current)
+	var waiting bool
+	for i, m := range s.members {
+		m.target = target[i]
+		kept := slices.DeleteFunc(slices.Clone(m.shards), func(shard uint16) bool {
+			return !slices.Contains(m.target, shard)
+		})
+		if len(kept) == len(m.shards) {
+			continue
+		}
+		m.shards = kept
+		m.awaiting = generation
+		waiting = true
+		m.send(message{Type: messageLease, Generation: generation, ShardCount: s.shardCount, Shards: kept})
+	}
+	// Shards released in the previous generation may still be running
+	for _, m := range s.members {
+		waiting = waiting || m.awaiting != 0
+	}
+	if !waiting {
+		s.assign()
+		return
+	}
+	time.AfterFunc(s.ackTimeout, func() {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		if s.generation != generation {
+			return
+		}
+		for _, m := range s.members {
+			if m.awaiting != 0 {
+				s.log.Warn().Param("process", m.name).Send("Process did not release its shards in time")
+				m.awaiting = 0
+			}
+		}
+		s.assign()
+	})
+}
+
+// assign sends the final leases. It must be called with mut held.
+func (s *Server) assign() {
+	for _, m := range s.members {
+		if m.leased && slices.Equal(m.shards, m.target) {
+			continue
+		}
+		m.shards = m.target
+		m.leased = true
+		s.log.Debug().Param("process", m.name).Param("shards", m.shards).Send("Shards leased")
+		m.send(message{Type: messageLease, Generation: s.generation, ShardCount: s.shardCount, Shards: m.shards})
+	}
+}
+
+func (s *Server) ack(m *member, generation uint64) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if m.awaiting == 0 || m.awaiting != generation {
+		return
+	}
+	m.awaiting = 0
+	for _, other := range s.members {
+		if other.awaiting != 0 {
+			return
+		}
+	}
+	s.assign()
+}
+
+// identify grants the identify when the rate limit bucket of the shard is free and a session start is left.
+// Slots are reserved by the identify scheduler in order, so a waiting process cannot be starved by the others.
+func (s *Server) identify(m *member, id uint64, shard uint16) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mut.Lock()
+	m.identifies[id] = cancel
+	s.mut.Unlock()
+	go func() {
+		defer s.cancelIdentify(m, id)
+		err := s.scheduler.Wait(ctx, shard)
+		switch {
+		case err == nil:
+			m.send(message{Type: messageIdentify, ID: id})
+		case errors.Is(err, ws.ErrSessionStartLimit):
+			_, resetAt := s.scheduler.Remaining()
+			s.log.Warn().Param("process", m.name).Param("shard", shard).Send("Session start limit is exhausted, identify denied")
+			m.send(message{Type: messageIdentify, ID: id, Denied: true, ResetAfter: time.Until(resetAt).Milliseconds()})
+		}
+	}()
+}
+
+// cancelIdentify gives back the session start of the identify, which is not granted yet.
+func (s *Server) cancelIdentify(m *member, id uint64) {
+	s.mut.Lock()
+	cancel, ok := m.identifies[id]
+	delete(m.identifies, id)
+	s.mut.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// NewServer creates coordinator splitting shardCount shards between processes. maxConcurrency is the
+// max_concurrency of the bot (see GET /gateway/bot), shared by all processes. Session start limit is shared
+// as well with WithSessionStartLimit.
+func NewServer(shardCount uint16, maxConcurrency int, opts ...ServerOption) *Server {
+	s := &Server{
+		shardCount: shardCount,
+		log:        golog.New("cluster"),
+		ackTimeout: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.scheduler = ws.NewIdentifyScheduler(s.log, maxConcurrency, s.identifyOpts...)
+	return s
+}
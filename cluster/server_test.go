@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+var testLogger = golog.NewCustom("test", func(golog.Message) {})
+
+func startServer(t *testing.T, count uint16, opts ...ServerOption) (*Server, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	s := NewServer(count, 1, append(opts, WithLogger(testLogger))...)
+	go s.Serve(l)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s, l.Addr().String()
+}
+
+// process joins the cluster and acknowledges its leases. Latest lease is sent to the returned channel.
+func process(t *testing.T, address string) (*Client, <-chan Lease) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, "tcp", address, WithClientLogger(testLogger))
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	lease, err := c.Join(ctx)
+	if err != nil {
+		t.Fatalf("failed to join: %s", err)
+	}
+	leases := make(chan Lease, 16)
+	leases <- lease
+	go func() {
+		for lease := range c.Leases() {
+			_ = c.Ack(lease)
+			leases <- lease
+		}
+	}()
+	return c, leases
+}
+
+// waitLease returns the first lease with given number of shards.
+func waitLease(t *testing.T, leases <-chan Lease, shards int) Lease {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case lease := <-leases:
+			if len(lease.Shards) == shards {
+				return lease
+			}
+		case <-timeout:
+			t.Fatalf("lease with %d shards was not received", shards)
+		}
+	}
+}
+
+func TestServerRebalance(t *testing.T) {
+	_, address := startServer(t, 6)
+	first, firstLeases := process(t, address)
+	waitLease(t, firstLeases, 6)
+	_, secondLeases := process(t, address)
+	waitLease(t, firstLeases, 3)
+	waitLease(t, secondLeases, 3)
+	_, thirdLeases := process(t, address)
+	waitLease(t, firstLeases, 2)
+	second := waitLease(t, secondLeases, 2)
+	third := waitLease(t, thirdLeases, 2)
+
+	_ = first.Close()
+	// Remaining processes keep their shards and take over the ones of the first process
+	for _, lease := range []struct {
+		before Lease
+		leases <-chan Lease
+	}{{second, secondLeases}, {third, thirdLeases}} {
+		after := waitLease(t, lease.leases, 3)
+		for _, shard := range lease.before.Shards {
+			if !after.Has(shard) {
+				t.Errorf("shard %d was moved: %v -> %v", shard, lease.before.Shards, after.Shards)
+			}
+		}
+	}
+}
+
+func TestServerSessionStartLimit(t *testing.T) {
+	_, address := startServer(t, 2, WithSessionStartLimit(1000, 1, time.Hour))
+	c, leases := process(t, address)
+	waitLease(t, leases, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Identify(ctx, 0); err != nil {
+		t.Fatalf("first identify failed: %s", err)
+	}
+	if err := c.Identify(ctx, 1); !errors.Is(err, ws.ErrSessionStartLimit) {
+		t.Fatalf("expected session start limit error, got %v", err)
+	}
+}
+
+func TestServerIdentifyCancel(t *testing.T) {
+	s, address := startServer(t, 2, WithSessionStartLimit(1000, 2, time.Hour))
+	c, leases := process(t, address)
+	waitLease(t, leases, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Identify(ctx, 0); err != nil {
+		t.Fatalf("first identify failed: %s", err)
+	}
+	// Second identify waits for the bucket, cancelling it gives back the session start
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if err := c.Identify(short, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	for remaining, _ := s.scheduler.Remaining(); remaining != 1; remaining, _ = s.scheduler.Remaining() {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("session start was not given back, %d left", remaining)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
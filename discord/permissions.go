@@ -15,7 +15,8 @@ func (p *Permission) UnmarshalJSON(b []byte) error {
 	if bytes.Equal(b, []byte("null")) {
 		return nil
 	}
-	if val, err := strconv.ParseUint(ubytes.ToString(b[1:len(b)-1]), 10, 64); err != nil {
+	// Permissions are strings in JSON, but ETF payloads carry them as plain numbers
+	if val, err := strconv.ParseUint(ubytes.ToString(bytes.Trim(b, `"`)), 10, 64); err != nil {
 		return fmt.Errorf("failed to parse permission: %w", err)
 	} else {
 		*p = Permission(val)
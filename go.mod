@@ -8,6 +8,7 @@ require (
 	github.com/andersfylling/snowflake/v5 v5.0.1
 	github.com/evanphx/json-patch v0.5.2
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.17.11
 	github.com/segmentio/encoding v0.4.1
 	github.com/valyala/fasthttp v1.57.0
 )
@@ -21,7 +22,6 @@ require (
 require (
 	github.com/andybalholm/brotli v1.1.1 // indirect
 	github.com/forPelevin/gomoji v1.2.0
-	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/segmentio/asm v1.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
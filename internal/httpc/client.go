@@ -1,11 +1,14 @@
 package httpc
 
 import (
+	"context"
+	"fmt"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/BOOMfinity/bfcord"
+	"github.com/BOOMfinity/bfcord/metrics"
 	"github.com/BOOMfinity/go-utils/rate"
 	"github.com/BOOMfinity/golog/v2"
 )
@@ -14,18 +17,43 @@ func ResolvePath(segments ...string) string {
 	return bfcord.APIUrl + "/" + bfcord.APIVersion + "/" + strings.Join(segments, "/")
 }
 
+// drainInterval is how often Drain checks the requests in flight.
+const drainInterval = 10 * time.Millisecond
+
 type Client struct {
 	token   string
 	log     golog.Logger
 	limiter *rate.Limiter
 	buckets *limiter
+	metrics *requestMetrics
 	id      atomic.Uint64
+	// inflight is the number of requests being executed
+	inflight atomic.Int64
+}
+
+// Drain waits until requests in flight are finished. New requests are not blocked, so they are awaited too.
+func (c *Client) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for c.inflight.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d request(s) still in flight: %w", c.inflight.Load(), ctx.Err())
+		}
+	}
+	return nil
 }
 
 func (c *Client) CustomGlobalLimiter(requests int) {
 	c.limiter = rate.NewLimiter(1*time.Second, requests)
 }
 
+// Metrics reports requests sent by the client to reg.
+func (c *Client) Metrics(reg metrics.Registry) {
+	c.metrics = newRequestMetrics(reg)
+}
+
 func NewClient(token string, log golog.Logger) *Client {
 	if log == nil {
 		log = golog.New("api")
@@ -38,5 +66,6 @@ func NewClient(token string, log golog.Logger) *Client {
 			log:     log.Module("buckets"),
 		},
 		limiter: rate.NewLimiter(1*time.Second, 50),
+		metrics: newRequestMetrics(nil),
 	}
 }
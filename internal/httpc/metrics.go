@@ -0,0 +1,67 @@
+package httpc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BOOMfinity/bfcord"
+	"github.com/BOOMfinity/bfcord/metrics"
+)
+
+type requestMetrics struct {
+	requests    metrics.Counter
+	duration    metrics.Histogram
+	rateLimited metrics.Counter
+}
+
+func (m *requestMetrics) request(method, route string, status int, took time.Duration) {
+	m.requests.Add(1, method, route, strconv.Itoa(status))
+	m.duration.Observe(took.Seconds(), method, route)
+}
+
+func (m *requestMetrics) limited(route, scope string) {
+	if scope == "" {
+		scope = "user"
+	}
+	m.rateLimited.Add(1, route, scope)
+}
+
+func newRequestMetrics(reg metrics.Registry) *requestMetrics {
+	reg = metrics.Or(reg)
+	return &requestMetrics{
+		requests:    reg.Counter("bfcord_rest_requests", "Requests sent to the Discord API.", "method", "route", "status"),
+		duration:    reg.Histogram("bfcord_rest_request_duration_seconds", "Time spent waiting for the Discord API response.", metrics.DefaultBuckets, "method", "route"),
+		rateLimited: reg.Counter("bfcord_rest_rate_limited", "Requests rejected with 429 status.", "route", "scope"),
+	}
+}
+
+// routeTemplate replaces ids, emojis and tokens in the url, so all requests to the same endpoint share one label value.
+func routeTemplate(url string) string {
+	url = strings.TrimPrefix(url, bfcord.APIUrl+"/"+bfcord.APIVersion)
+	if i := strings.IndexByte(url, '?'); i != -1 {
+		url = url[:i]
+	}
+	segments := strings.Split(url, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+		case i > 0 && segments[i-1] == "reactions":
+			segments[i] = ":emoji"
+		case i > 1 && (segments[i-2] == "webhooks" || segments[i-2] == "interactions"):
+			segments[i] = ":token"
+		case isNumeric(segment):
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
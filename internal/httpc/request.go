@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"mime/multipart"
 	"strings"
+	"time"
 
 	"github.com/BOOMfinity/golog/v2"
 	"github.com/segmentio/encoding/json"
@@ -129,6 +130,8 @@ func (b *requestBuilderImpl) NoAuth() RequestBuilder {
 }
 
 func (b *requestBuilderImpl) Execute(segments ...string) error {
+	b.client.inflight.Add(1)
+	defer b.client.inflight.Add(-1)
 	url := ResolvePath(segments...)
 	req := fasthttp.AcquireRequest()
 	res := fasthttp.AcquireResponse()
@@ -145,16 +148,21 @@ func (b *requestBuilderImpl) Execute(segments ...string) error {
 			return errors.Join(ErrFailedToParseRequestOptions, err)
 		}
 	}
+	route := routeTemplate(url)
+	method := string(req.Header.Method())
 	for r := (uint)(0); r < b.limit; r++ {
 		_ = b.client.limiter.Wait(context.Background())
 		if err := b.client.buckets.Acquire(context.Background(), url); err != nil {
 			return fmt.Errorf("failed to acquire the bucket: %w", err)
 		}
 		b.log.Trace().Param("retries", r).Send("Sending request to the '%s' with %d bytes of body", url, len(req.Body()))
+		start := time.Now()
 		if err := fasthttp.Do(req, res); err != nil {
 			return fmt.Errorf("failed to send the request: %w", err)
 		}
+		b.client.metrics.request(method, route, res.StatusCode(), time.Since(start))
 		if res.StatusCode() == fasthttp.StatusTooManyRequests {
+			b.client.metrics.limited(route, string(res.Header.Peek("X-RateLimit-Scope")))
 			if err := b.client.buckets.Release(url, &res.Header); err != nil {
 				return fmt.Errorf("failed to release the bucket: %w", err)
 			}
@@ -0,0 +1,61 @@
+// Package metrics defines the registry used by gateway, session and REST client to report their metrics.
+//
+// Registry can be implemented to forward metrics to any monitoring system. NewRegistry creates an in-memory
+// implementation, which serves them in OpenMetrics text format.
+package metrics
+
+// DefaultBuckets are histogram buckets (in seconds) suitable for latencies of handlers and requests.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter is a value that only goes up. Label values have to be passed in the same order as label names.
+type Counter interface {
+	Add(delta float64, labels ...string)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge interface {
+	Set(value float64, labels ...string)
+	Add(delta float64, labels ...string)
+}
+
+// Histogram counts observations in buckets.
+type Histogram interface {
+	Observe(value float64, labels ...string)
+}
+
+// Registry creates metrics. Requesting a metric with the same name twice has to return the same metric,
+// as every shard asks for its own instance.
+type Registry interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+type discard struct{}
+
+func (discard) Add(float64, ...string)     {}
+func (discard) Set(float64, ...string)     {}
+func (discard) Observe(float64, ...string) {}
+
+func (d discard) Counter(string, string, ...string) Counter {
+	return d
+}
+
+func (d discard) Gauge(string, string, ...string) Gauge {
+	return d
+}
+
+func (d discard) Histogram(string, string, []float64, ...string) Histogram {
+	return d
+}
+
+// Discard is a Registry that ignores all metrics. It is used when no registry is configured.
+var Discard Registry = discard{}
+
+// Or returns reg, or Discard if reg is nil.
+func Or(reg Registry) Registry {
+	if reg == nil {
+		return Discard
+	}
+	return reg
+}
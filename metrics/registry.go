@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	mut     sync.Mutex
+}
+
+// get returns series with given label values. It must be called with mut held.
+func (f *family) get(labels []string) *series {
+	if len(labels) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labels)))
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: slices.Clone(labels)}
+		if f.typ == typeHistogram {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) Add(delta float64, labels ...string) {
+	f.mut.Lock()
+	f.get(labels).value += delta
+	f.mut.Unlock()
+}
+
+func (f *family) Set(value float64, labels ...string) {
+	f.mut.Lock()
+	f.get(labels).value = value
+	f.mut.Unlock()
+}
+
+func (f *family) Observe(value float64, labels ...string) {
+	f.mut.Lock()
+	s := f.get(labels)
+	// Buckets are cumulative in the exposition, so only the first matching one is incremented here
+	if i, _ := slices.BinarySearch(f.buckets, value); i < len(s.buckets) {
+		s.buckets[i]++
+	}
+	s.value += value
+	s.count++
+	f.mut.Unlock()
+}
+
+// MemoryRegistry keeps metrics in memory and serves them in OpenMetrics text format.
+type MemoryRegistry struct {
+	families map[string]*family
+	mut      sync.Mutex
+}
+
+func (r *MemoryRegistry) family(name, help string, typ metricType, buckets []float64, labels []string) *family {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ {
+			panic(fmt.Sprintf("metric %s is already registered as %s", name, f.typ))
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  slices.Clone(labels),
+		buckets: slices.Sorted(slices.Values(buckets)),
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+func (r *MemoryRegistry) Counter(name, help string, labels ...string) Counter {
+	return r.family(name, help, typeCounter, nil, labels)
+}
+
+func (r *MemoryRegistry) Gauge(name, help string, labels ...string) Gauge {
+	return r.family(name, help, typeGauge, nil, labels)
+}
+
+func (r *MemoryRegistry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return r.family(name, help, typeHistogram, buckets, labels)
+}
+
+// WriteTo writes all metrics in OpenMetrics text format.
+func (r *MemoryRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mut.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mut.Unlock()
+	slices.SortFunc(families, func(a, b *family) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	cw.WriteString("# EOF\n")
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (r *MemoryRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_, _ = r.WriteTo(w)
+}
+
+func (f *family) write(w *countingWriter) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	w.WriteString("# TYPE " + f.name + " " + string(f.typ) + "\n")
+	if f.help != "" {
+		w.WriteString("# HELP " + f.name + " " + escape(f.help, false) + "\n")
+	}
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		switch f.typ {
+		case typeCounter:
+			w.sample(f.name+"_total", f.labels, s.labels, "", "", s.value)
+		case typeGauge:
+			w.sample(f.name, f.labels, s.labels, "", "", s.value)
+		case typeHistogram:
+			var cumulative uint64
+			for i, bound := range f.buckets {
+				cumulative += s.buckets[i]
+				w.sample(f.name+"_bucket", f.labels, s.labels, "le", formatFloat(bound), float64(cumulative))
+			}
+			w.sample(f.name+"_bucket", f.labels, s.labels, "le", "+Inf", float64(s.count))
+			w.sample(f.name+"_sum", f.labels, s.labels, "", "", s.value)
+			w.sample(f.name+"_count", f.labels, s.labels, "", "", float64(s.count))
+		}
+	}
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) WriteString(s string) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.WriteString(s)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countingWriter) sample(name string, names, values []string, extraName, extraValue string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(names) > 0 || extraName != "" {
+		b.WriteByte('{')
+		for i, label := range names {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(label + `="` + escape(values[i], true) + `"`)
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+	w.WriteString(b.String())
+}
+
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// NewRegistry creates in-memory Registry. It implements http.Handler, so it can be mounted as a scrape endpoint.
+func NewRegistry() *MemoryRegistry {
+	return &MemoryRegistry{families: make(map[string]*family)}
+}
@@ -13,3 +13,19 @@ type ServerUpdateEvent struct {
 	GuildID  snowflake.ID `json:"guild_id,omitempty"`
 	Endpoint string       `json:"endpoint,omitempty"`
 }
+
+// Reallocating reports if the voice server has gone away (endpoint is null) and Discord is allocating a new one.
+// Current voice connection should be closed and a new one should not be opened until the next server update with an endpoint.
+func (e ServerUpdateEvent) Reallocating() bool {
+	return e.Endpoint == ""
+}
+
+// Credentials contains everything needed to open a voice connection.
+type Credentials struct {
+	GuildID   snowflake.ID
+	ChannelID snowflake.ID
+	UserID    snowflake.ID
+	SessionID string
+	Token     string
+	Endpoint  string
+}
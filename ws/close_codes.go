@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseAction tells what the gateway does after Discord closes the connection with given code.
+type CloseAction uint8
+
+const (
+	// CloseActionResume reconnects and resumes the session.
+	CloseActionResume CloseAction = iota
+	// CloseActionReidentify reconnects with a new session.
+	CloseActionReidentify
+	// CloseActionFatal stops reconnecting, as the configuration has to be fixed first.
+	CloseActionFatal
+)
+
+type closeCode struct {
+	name   string
+	action CloseAction
+}
+
+var closeCodes = map[int]closeCode{
+	4000: {"unknown error", CloseActionResume},
+	4001: {"unknown opcode", CloseActionResume},
+	4002: {"decode error", CloseActionResume},
+	4003: {"not authenticated", CloseActionReidentify},
+	4004: {"authentication failed", CloseActionFatal},
+	4005: {"already authenticated", CloseActionResume},
+	4007: {"invalid seq", CloseActionReidentify},
+	4008: {"rate limited", CloseActionResume},
+	4009: {"session timed out", CloseActionReidentify},
+	4010: {"invalid shard", CloseActionFatal},
+	4011: {"sharding required", CloseActionFatal},
+	4012: {"invalid API version", CloseActionFatal},
+	4013: {"invalid intents", CloseActionFatal},
+	4014: {"disallowed intents", CloseActionFatal},
+}
+
+var (
+	ErrCloseUnknownError         = CloseError{Code: 4000}
+	ErrCloseUnknownOpcode        = CloseError{Code: 4001}
+	ErrCloseDecodeError          = CloseError{Code: 4002}
+	ErrCloseNotAuthenticated     = CloseError{Code: 4003}
+	ErrCloseAuthenticationFailed = CloseError{Code: 4004}
+	ErrCloseAlreadyAuthenticated = CloseError{Code: 4005}
+	ErrCloseInvalidSeq           = CloseError{Code: 4007}
+	ErrCloseRateLimited          = CloseError{Code: 4008}
+	ErrCloseSessionTimedOut      = CloseError{Code: 4009}
+	ErrCloseInvalidShard         = CloseError{Code: 4010}
+	ErrCloseShardingRequired     = CloseError{Code: 4011}
+	ErrCloseInvalidAPIVersion    = CloseError{Code: 4012}
+	ErrCloseInvalidIntents       = CloseError{Code: 4013}
+	ErrCloseDisallowedIntents    = CloseError{Code: 4014}
+)
+
+// CloseError is returned when Discord closes the connection with one of the gateway close codes.
+// It can be compared with errors.Is to the ErrClose* variables, which match by the code only.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e CloseError) Error() string {
+	msg := fmt.Sprintf("gateway closed with code %d (%s)", e.Code, closeCodes[e.Code].name)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func (e CloseError) Is(target error) bool {
+	t, ok := target.(CloseError)
+	return ok && t.Code == e.Code
+}
+
+// Action returns what the gateway does after receiving this close code.
+func (e CloseError) Action() CloseAction {
+	return closeCodes[e.Code].action
+}
+
+// Fatal reports whether the gateway stops reconnecting after this close code.
+func (e CloseError) Fatal() bool {
+	return e.Action() == CloseActionFatal
+}
+
+// closeError translates websocket close errors with gateway close codes to CloseError.
+// Other errors (like network errors or standard close codes) are returned unchanged, as they are resumable.
+func closeError(err error) error {
+	var wsErr *websocket.CloseError
+	if !errors.As(err, &wsErr) {
+		return err
+	}
+	if _, ok := closeCodes[wsErr.Code]; !ok {
+		return err
+	}
+	return CloseError{Code: wsErr.Code, Reason: wsErr.Text}
+}
+
+// closeCodeOf returns the close code received with err, 0 if the connection was not closed with a close frame.
+func closeCodeOf(err error) int {
+	var closeErr CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code
+	}
+	var wsErr *websocket.CloseError
+	if errors.As(err, &wsErr) {
+		return wsErr.Code
+	}
+	return 0
+}
+
+// closeAction returns what should be done after the connection failed with given error.
+func closeAction(err error) CloseAction {
+	// Identifying again would fail as well, until the limit is reset
+	if errors.Is(err, ErrSessionStartLimit) {
+		return CloseActionFatal
+	}
+	var closeErr CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Action()
+	}
+	return CloseActionResume
+}
@@ -0,0 +1,146 @@
+package ws
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a transport compression used for the whole gateway connection.
+type Compression string
+
+const (
+	CompressionNone       Compression = ""
+	CompressionZlibStream Compression = "zlib-stream"
+	CompressionZstdStream Compression = "zstd-stream"
+)
+
+var zlibSuffix = []byte{0x00, 0x00, 0xff, 0xff}
+
+var errInflaterClosed = errors.New("inflater is closed")
+
+// inflater decompresses binary messages of a single gateway connection.
+//
+// Discord keeps one compression context for the whole connection, so the underlying decoder lives in its own goroutine
+// and is fed with the compressed messages one by one. When the decoder asks for more input than the current message has,
+// all the output of that message has already been written.
+type inflater struct {
+	compression Compression
+	in          chan []byte
+	done        chan error
+	data        []byte
+	fed         bool
+	dst         *bytes.Buffer
+	err         error
+	closed      bool
+	mut         sync.Mutex
+}
+
+func (f *inflater) Read(p []byte) (int, error) {
+	for len(f.data) == 0 {
+		if f.fed {
+			f.done <- nil
+		}
+		data, ok := <-f.in
+		if !ok {
+			return 0, io.EOF
+		}
+		f.data = data
+		f.fed = true
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func (f *inflater) decoder() (io.Reader, error) {
+	switch f.compression {
+	case CompressionZlibStream:
+		return zlib.NewReader(f)
+	case CompressionZstdStream:
+		dec, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression '%s'", f.compression)
+	}
+}
+
+func (f *inflater) loop() {
+	r, err := f.decoder()
+	if err != nil {
+		f.done <- fmt.Errorf("could not create %s decoder: %w", f.compression, err)
+		return
+	}
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+	buff := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buff)
+		if n > 0 {
+			f.dst.Write(buff[:n])
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			f.done <- fmt.Errorf("%s stream broken: %w", f.compression, err)
+			return
+		}
+	}
+}
+
+// Inflate decompresses data and appends the result to dst. It returns false if the message is not complete yet
+// and the output should be kept until the next message arrives.
+func (f *inflater) Inflate(dst *bytes.Buffer, data []byte) (complete bool, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return false, errInflaterClosed
+	}
+	if f.err != nil {
+		return false, f.err
+	}
+	f.dst = dst
+	select {
+	case f.in <- data:
+	case f.err = <-f.done:
+		return false, f.err
+	}
+	if f.err = <-f.done; f.err != nil {
+		return false, f.err
+	}
+	if f.compression == CompressionZlibStream {
+		return bytes.HasSuffix(data, zlibSuffix), nil
+	}
+	return true, nil
+}
+
+// Close stops the decoder goroutine. Inflater cannot be used after that.
+func (f *inflater) Close() {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.in)
+}
+
+func newInflater(compression Compression) *inflater {
+	f := &inflater{
+		compression: compression,
+		in:          make(chan []byte),
+		done:        make(chan error, 1),
+	}
+	go f.loop()
+	return f
+}
@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// flushWriter is a compressor keeping one context for the whole stream, like the gateway does.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+func TestInflater(t *testing.T) {
+	messages := []string{
+		`{"op":10,"d":{"heartbeat_interval":41250}}`,
+		`{"op":0,"t":"READY","s":1,"d":{"v":10}}`,
+		`{"op":0,"t":"MESSAGE_CREATE","s":2,"d":{"content":"` + strings.Repeat("bfcord ", 10000) + `"}}`,
+		`{"op":11,"d":null}`,
+	}
+	tests := []struct {
+		compression Compression
+		writer      func(w io.Writer) flushWriter
+	}{
+		{compression: CompressionZlibStream, writer: func(w io.Writer) flushWriter {
+			return zlib.NewWriter(w)
+		}},
+		{compression: CompressionZstdStream, writer: func(w io.Writer) flushWriter {
+			enc, _ := zstd.NewWriter(w)
+			return enc
+		}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.compression), func(t *testing.T) {
+			f := newInflater(test.compression)
+			defer f.Close()
+			var compressed bytes.Buffer
+			w := test.writer(&compressed)
+			for i, msg := range messages {
+				_, _ = w.Write([]byte(msg))
+				if err := w.Flush(); err != nil {
+					t.Fatalf("failed to flush message %d: %s", i, err)
+				}
+				var dst bytes.Buffer
+				complete, err := f.Inflate(&dst, compressed.Bytes())
+				compressed.Reset()
+				if err != nil {
+					t.Fatalf("failed to inflate message %d: %s", i, err)
+				}
+				if !complete {
+					t.Fatalf("message %d is not complete", i)
+				}
+				if dst.String() != msg {
+					t.Fatalf("message %d: expected %d bytes, got %d", i, len(msg), dst.Len())
+				}
+			}
+		})
+	}
+}
+
+func TestInflaterSplitMessage(t *testing.T) {
+	f := newInflater(CompressionZlibStream)
+	defer f.Close()
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	msg := `{"op":0,"t":"READY","s":1,"d":{"v":10}}`
+	_, _ = w.Write([]byte(msg))
+	_ = w.Flush()
+	data := compressed.Bytes()
+	var dst bytes.Buffer
+	// Message without the zlib suffix is not complete yet
+	complete, err := f.Inflate(&dst, data[:len(data)/2])
+	if err != nil || complete {
+		t.Fatalf("expected incomplete message, got complete %v and %v", complete, err)
+	}
+	if complete, err = f.Inflate(&dst, data[len(data)/2:]); err != nil || !complete {
+		t.Fatalf("expected complete message, got complete %v and %v", complete, err)
+	}
+	if dst.String() != msg {
+		t.Fatalf("expected %q, got %q", msg, dst.String())
+	}
+}
+
+func TestInflaterBrokenStream(t *testing.T) {
+	f := newInflater(CompressionZlibStream)
+	defer f.Close()
+	var dst bytes.Buffer
+	if _, err := f.Inflate(&dst, []byte("not zlib at all\x00\x00\xff\xff")); err == nil {
+		t.Fatal("expected error for broken stream")
+	}
+	// The stream cannot be recovered
+	if _, err := f.Inflate(&dst, []byte{0x78, 0x9c}); err == nil {
+		t.Fatal("expected error after the stream broke")
+	}
+	f.Close()
+	if _, err := f.Inflate(&dst, nil); err != errInflaterClosed {
+		t.Fatalf("expected %v, got %v", errInflaterClosed, err)
+	}
+}
@@ -0,0 +1,13 @@
+package ws
+
+// Encoding translates gateway payloads between the wire format and JSON, which is used by the rest of the library.
+//
+// If Config.Encoding is nil, JSON is used as is. Payloads of other encodings are sent as binary messages.
+type Encoding interface {
+	// Name is sent as the encoding query parameter.
+	Name() string
+	// Decode appends JSON representation of the payload to dst.
+	Decode(dst, data []byte) ([]byte, error)
+	// Encode marshals v into the wire format.
+	Encode(v any) ([]byte, error)
+}
@@ -10,6 +10,14 @@ import (
 var (
 	ErrGatewayNotConnected     = errors.New("gateway is disconnected from Discord")
 	ErrFetchingMembersTimedOut = errors.New("could not wait longer for guild members chunk")
+	ErrSendDropped             = errors.New("message was dropped because the connection was closed")
+	ErrSendExpired             = errors.New("message expired before it could be sent")
+	ErrSendQueueFull           = errors.New("send queue is full")
+	ErrReplayReadOnly          = errors.New("replay gateway cannot send messages to Discord")
+	ErrReplayStarted           = errors.New("replay has already been started")
+	ErrRecorderClosed          = errors.New("recorder has already been closed")
+	ErrSessionStartLimit       = errors.New("session start limit is exhausted")
+	ErrHeartbeatTimeout        = errors.New("heartbeat ACK was not received in time")
 )
 
 type ErrNotFound []snowflake.ID
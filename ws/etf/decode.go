@@ -0,0 +1,348 @@
+package etf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+)
+
+const hex = "0123456789abcdef"
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, ErrUnexpectedEnd
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint8() (uint8, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) uint16() (uint16, error) {
+	b, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (d *decoder) term(dst []byte, depth int) ([]byte, error) {
+	if depth > maxNestingDepth {
+		return dst, ErrMaxDepthReached
+	}
+	tag, err := d.uint8()
+	if err != nil {
+		return dst, err
+	}
+	switch tag {
+	case tagSmallInteger:
+		v, err := d.uint8()
+		if err != nil {
+			return dst, err
+		}
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case tagInteger:
+		v, err := d.uint32()
+		if err != nil {
+			return dst, err
+		}
+		return strconv.AppendInt(dst, int64(int32(v)), 10), nil
+	case tagNewFloat:
+		b, err := d.read(8)
+		if err != nil {
+			return dst, err
+		}
+		return appendFloat(dst, math.Float64frombits(binary.BigEndian.Uint64(b))), nil
+	case tagFloat:
+		b, err := d.read(31)
+		if err != nil {
+			return dst, err
+		}
+		f, err := strconv.ParseFloat(string(bytes.TrimRight(b, "\x00")), 64)
+		if err != nil {
+			return dst, fmt.Errorf("invalid float: %w", err)
+		}
+		return appendFloat(dst, f), nil
+	case tagSmallBig, tagLargeBig:
+		var n int
+		if tag == tagSmallBig {
+			v, err := d.uint8()
+			if err != nil {
+				return dst, err
+			}
+			n = int(v)
+		} else {
+			v, err := d.uint32()
+			if err != nil {
+				return dst, err
+			}
+			n = int(v)
+		}
+		sign, err := d.uint8()
+		if err != nil {
+			return dst, err
+		}
+		digits, err := d.read(n)
+		if err != nil {
+			return dst, err
+		}
+		return appendBig(dst, sign != 0, digits), nil
+	case tagAtom, tagAtomUTF8:
+		n, err := d.uint16()
+		if err != nil {
+			return dst, err
+		}
+		return d.atom(dst, int(n))
+	case tagSmallAtom, tagSmallAtomUTF8:
+		n, err := d.uint8()
+		if err != nil {
+			return dst, err
+		}
+		return d.atom(dst, int(n))
+	case tagBinary:
+		n, err := d.uint32()
+		if err != nil {
+			return dst, err
+		}
+		b, err := d.read(int(n))
+		if err != nil {
+			return dst, err
+		}
+		return appendString(dst, b), nil
+	case tagString:
+		n, err := d.uint16()
+		if err != nil {
+			return dst, err
+		}
+		b, err := d.read(int(n))
+		if err != nil {
+			return dst, err
+		}
+		return appendString(dst, b), nil
+	case tagNil:
+		return append(dst, "[]"...), nil
+	case tagList:
+		n, err := d.uint32()
+		if err != nil {
+			return dst, err
+		}
+		if dst, err = d.array(dst, int(n), depth); err != nil {
+			return dst, err
+		}
+		// Proper lists end with NIL_EXT, improper tails are not representable in JSON
+		if tail, err := d.term(nil, depth+1); err != nil {
+			return dst, err
+		} else if string(tail) != "[]" {
+			return dst, fmt.Errorf("improper lists are not supported")
+		}
+		return dst, nil
+	case tagSmallTuple:
+		n, err := d.uint8()
+		if err != nil {
+			return dst, err
+		}
+		return d.array(dst, int(n), depth)
+	case tagLargeTuple:
+		n, err := d.uint32()
+		if err != nil {
+			return dst, err
+		}
+		return d.array(dst, int(n), depth)
+	case tagMap:
+		n, err := d.uint32()
+		if err != nil {
+			return dst, err
+		}
+		return d.object(dst, int(n), depth)
+	case tagCompressed:
+		return d.compressed(dst, depth)
+	default:
+		return dst, ErrUnsupportedTag(tag)
+	}
+}
+
+func (d *decoder) atom(dst []byte, n int) ([]byte, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return dst, err
+	}
+	switch string(b) {
+	case "nil", "null":
+		return append(dst, "null"...), nil
+	case "true", "false":
+		return append(dst, b...), nil
+	default:
+		return appendString(dst, b), nil
+	}
+}
+
+func (d *decoder) array(dst []byte, n int, depth int) (_ []byte, err error) {
+	dst = append(dst, '[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		if dst, err = d.term(dst, depth+1); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (d *decoder) object(dst []byte, n int, depth int) (_ []byte, err error) {
+	dst = append(dst, '{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		// JSON keys have to be strings, so numbers and other scalar keys are quoted
+		start := len(dst)
+		if dst, err = d.term(dst, depth+1); err != nil {
+			return dst, err
+		}
+		if dst[start] != '"' {
+			key := string(dst[start:])
+			dst = appendString(dst[:start], []byte(key))
+		}
+		dst = append(dst, ':')
+		if dst, err = d.term(dst, depth+1); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+func (d *decoder) compressed(dst []byte, depth int) ([]byte, error) {
+	size, err := d.uint32()
+	if err != nil {
+		return dst, err
+	}
+	if size > maxCompressedSize {
+		return dst, fmt.Errorf("compressed term is too big (%d bytes)", size)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(d.data[d.pos:]))
+	if err != nil {
+		return dst, fmt.Errorf("invalid compressed term: %w", err)
+	}
+	defer r.Close()
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return dst, fmt.Errorf("invalid compressed term: %w", err)
+	}
+	// Compressed term is always the last one, so the rest of the input is consumed
+	d.pos = len(d.data)
+	inner := &decoder{data: data}
+	return inner.term(dst, depth+1)
+}
+
+func appendFloat(dst []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(dst, "null"...)
+	}
+	return strconv.AppendFloat(dst, f, 'g', -1, 64)
+}
+
+func appendBig(dst []byte, negative bool, digits []byte) []byte {
+	if len(digits) <= 8 {
+		var v uint64
+		for i := len(digits) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(digits[i])
+		}
+		if negative {
+			dst = append(dst, '-')
+		}
+		return strconv.AppendUint(dst, v, 10)
+	}
+	be := make([]byte, len(digits))
+	for i, b := range digits {
+		be[len(digits)-1-i] = b
+	}
+	v := new(big.Int).SetBytes(be)
+	if negative {
+		v.Neg(v)
+	}
+	return v.Append(dst, 10)
+}
+
+func appendString(dst []byte, s []byte) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i++
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// ToJSON appends JSON representation of the term to dst.
+//
+// Atoms are translated to strings (except true, false and nil), tuples and lists to arrays and big integers
+// (like snowflakes) to numbers.
+func ToJSON(dst, data []byte) ([]byte, error) {
+	d := &decoder{data: data}
+	v, err := d.uint8()
+	if err != nil {
+		return dst, err
+	}
+	if v != version {
+		return dst, ErrInvalidVersion
+	}
+	return d.term(dst, 0)
+}
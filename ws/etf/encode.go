@@ -0,0 +1,110 @@
+package etf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func appendAtom(dst []byte, name string) []byte {
+	dst = append(dst, tagSmallAtomUTF8, uint8(len(name)))
+	return append(dst, name...)
+}
+
+func appendInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= math.MaxUint8:
+		return append(dst, tagSmallInteger, uint8(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		dst = append(dst, tagInteger)
+		return binary.BigEndian.AppendUint32(dst, uint32(int32(v)))
+	case v < 0:
+		return appendUint(dst, uint64(-v), true)
+	default:
+		return appendUint(dst, uint64(v), false)
+	}
+}
+
+func appendUint(dst []byte, v uint64, negative bool) []byte {
+	if !negative && v <= math.MaxInt32 {
+		return appendInt(dst, int64(v))
+	}
+	header := len(dst)
+	dst = append(dst, tagSmallBig, 0, 0)
+	if negative {
+		dst[header+2] = 1
+	}
+	n := 0
+	for ; v > 0; v >>= 8 {
+		dst = append(dst, uint8(v))
+		n++
+	}
+	dst[header+1] = uint8(n)
+	return dst
+}
+
+func appendValue(dst []byte, v any) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		return appendAtom(dst, "nil"), nil
+	case bool:
+		return appendAtom(dst, strconv.FormatBool(v)), nil
+	case string:
+		dst = append(dst, tagBinary)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(v)))
+		return append(dst, v...), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return appendInt(dst, i), nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return appendUint(dst, u, false), nil
+		}
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return dst, fmt.Errorf("invalid number %s: %w", v, err)
+		}
+		dst = append(dst, tagNewFloat)
+		return binary.BigEndian.AppendUint64(dst, math.Float64bits(f)), nil
+	case []any:
+		if len(v) == 0 {
+			return append(dst, tagNil), nil
+		}
+		dst = append(dst, tagList)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(v)))
+		for _, item := range v {
+			if dst, err = appendValue(dst, item); err != nil {
+				return dst, err
+			}
+		}
+		return append(dst, tagNil), nil
+	case map[string]any:
+		dst = append(dst, tagMap)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(v)))
+		for key, item := range v {
+			if dst, err = appendValue(dst, key); err != nil {
+				return dst, err
+			}
+			if dst, err = appendValue(dst, item); err != nil {
+				return dst, err
+			}
+		}
+		return dst, nil
+	default:
+		return dst, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// FromJSON appends a term representing JSON data to dst. Object keys and strings are encoded as binaries.
+func FromJSON(dst, data []byte) ([]byte, error) {
+	var v any
+	if _, err := json.Parse(data, &v, json.UseNumber); err != nil {
+		return dst, fmt.Errorf("failed to parse json: %w", err)
+	}
+	dst = append(dst, version)
+	return appendValue(dst, v)
+}
@@ -0,0 +1,81 @@
+// Package etf implements Erlang External Term Format used by the Discord Gateway when connected with encoding=etf.
+//
+// Terms are translated from and to JSON, so payloads can be decoded into the same structures as regular JSON events.
+package etf
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/encoding/json"
+)
+
+const version = 131
+
+const (
+	tagNewFloat       = 70
+	tagCompressed     = 80
+	tagSmallInteger   = 97
+	tagInteger        = 98
+	tagFloat          = 99
+	tagAtom           = 100
+	tagSmallTuple     = 104
+	tagLargeTuple     = 105
+	tagNil            = 106
+	tagString         = 107
+	tagList           = 108
+	tagBinary         = 109
+	tagSmallBig       = 110
+	tagLargeBig       = 111
+	tagSmallAtom      = 115
+	tagMap            = 116
+	tagAtomUTF8       = 118
+	tagSmallAtomUTF8  = 119
+	maxNestingDepth   = 256
+	maxCompressedSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrInvalidVersion  = errors.New("invalid etf version byte")
+	ErrUnexpectedEnd   = errors.New("unexpected end of etf data")
+	ErrMaxDepthReached = errors.New("etf term is nested too deeply")
+)
+
+type ErrUnsupportedTag uint8
+
+func (e ErrUnsupportedTag) Error() string {
+	return fmt.Sprintf("unsupported etf tag %d", uint8(e))
+}
+
+// Encoding can be used as ws.Config Encoding to connect with encoding=etf.
+type Encoding struct{}
+
+func (Encoding) Name() string {
+	return "etf"
+}
+
+func (Encoding) Decode(dst, data []byte) ([]byte, error) {
+	return ToJSON(dst, data)
+}
+
+func (Encoding) Encode(v any) ([]byte, error) {
+	return Marshal(v)
+}
+
+// Marshal encodes v as a term. Value is marshalled with its JSON representation, so json tags and custom marshalers are respected.
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return FromJSON(nil, data)
+}
+
+// Unmarshal decodes a term into v just like it would be decoded from JSON.
+func Unmarshal(data []byte, v any) error {
+	out, err := ToJSON(nil, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(out, v)
+}
@@ -0,0 +1,131 @@
+package etf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// term builds the term data with the version byte.
+func term(parts ...[]byte) []byte {
+	return append([]byte{version}, bytes.Join(parts, nil)...)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func compressedTerm(inner []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(inner)
+	_ = w.Close()
+	return bytes.Join([][]byte{{tagCompressed}, u32(uint32(len(inner))), buf.Bytes()}, nil)
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{name: "small integer", data: term([]byte{tagSmallInteger, 200}), expected: `200`},
+		{name: "negative integer", data: term([]byte{tagInteger}, u32(uint32(0xffffff9c))), expected: `-100`},
+		{name: "new float", data: term([]byte{tagNewFloat}, binary.BigEndian.AppendUint64(nil, math.Float64bits(1.5))), expected: `1.5`},
+		{name: "snowflake", data: term([]byte{tagSmallBig, 8, 0}, binary.LittleEndian.AppendUint64(nil, 1234567890123456789)), expected: `1234567890123456789`},
+		{name: "negative big", data: term([]byte{tagSmallBig, 1, 1, 5}), expected: `-5`},
+		{name: "nil atom", data: term([]byte{tagSmallAtomUTF8, 3}, []byte("nil")), expected: `null`},
+		{name: "true atom", data: term([]byte{tagAtom, 0, 4}, []byte("true")), expected: `true`},
+		{name: "other atom", data: term([]byte{tagSmallAtom, 5}, []byte("hello")), expected: `"hello"`},
+		{name: "binary with escapes", data: term([]byte{tagBinary}, u32(6), []byte("a\"b\\\n\x01")), expected: `"a\"b\\\n\u0001"`},
+		{name: "string", data: term([]byte{tagString, 0, 2}, []byte("hi")), expected: `"hi"`},
+		{name: "empty list", data: term([]byte{tagNil}), expected: `[]`},
+		{name: "list", data: term([]byte{tagList}, u32(2), []byte{tagSmallInteger, 1, tagSmallInteger, 2, tagNil}), expected: `[1,2]`},
+		{name: "tuple", data: term([]byte{tagSmallTuple, 2, tagSmallInteger, 1, tagNil}), expected: `[1,[]]`},
+		{name: "map", data: term([]byte{tagMap}, u32(2), []byte{tagBinary}, u32(1), []byte("a"), []byte{tagSmallInteger, 1, tagSmallInteger, 7, tagSmallAtomUTF8, 4}, []byte("true")), expected: `{"a":1,"7":true}`},
+		{name: "compressed", data: term(compressedTerm([]byte{tagList, 0, 0, 0, 1, tagSmallInteger, 3, tagNil})), expected: `[3]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ToJSON(nil, test.data)
+			if err != nil {
+				t.Fatalf("failed to decode: %s", err)
+			}
+			if string(out) != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, out)
+			}
+		})
+	}
+}
+
+func TestToJSONErrors(t *testing.T) {
+	deep := []byte{version}
+	for range maxNestingDepth + 1 {
+		deep = append(deep, tagSmallTuple, 1)
+	}
+	deep = append(deep, tagNil)
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{name: "empty", data: nil, expected: ErrUnexpectedEnd},
+		{name: "invalid version", data: []byte{130, tagNil}, expected: ErrInvalidVersion},
+		{name: "truncated", data: term([]byte{tagBinary}, u32(10), []byte("abc")), expected: ErrUnexpectedEnd},
+		{name: "unsupported tag", data: term([]byte{tagSmallTuple, 1, 120}), expected: ErrUnsupportedTag(120)},
+		{name: "too deep", data: deep, expected: ErrMaxDepthReached},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ToJSON(nil, test.data); !errors.Is(err, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type payload struct {
+		OpCode  uint           `json:"op"`
+		Seq     *uint64        `json:"s"`
+		Event   string         `json:"t"`
+		Data    map[string]any `json:"d"`
+		Shard   []uint16       `json:"shard"`
+		Guild   uint64         `json:"guild_id,string"`
+		Big     uint64         `json:"big"`
+		Delta   int64          `json:"delta"`
+		Ratio   float64        `json:"ratio"`
+		Enabled bool           `json:"enabled"`
+	}
+	in := payload{
+		OpCode:  2,
+		Event:   "IDENTIFY",
+		Data:    map[string]any{"token": "secret", "large_threshold": json.Number("250"), "list": []any{"a", json.Number("1")}},
+		Shard:   []uint16{1, 16},
+		Guild:   1234567890123456789,
+		Big:     math.MaxUint64,
+		Delta:   -3000000000,
+		Ratio:   0.25,
+		Enabled: true,
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	var out payload
+	if err = Unmarshal(data, &out); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	// Numbers of d are decoded as float64 without UseNumber
+	in.Data["large_threshold"] = float64(250)
+	in.Data["list"] = []any{"a", float64(1)}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("expected %+v, got %+v", in, out)
+	}
+}
@@ -0,0 +1,216 @@
+package ws
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+
+	"github.com/andersfylling/snowflake/v5"
+)
+
+// EventFilter decides which dispatches are decoded and delivered to listeners. It is called with the raw event name
+// (t field) before the payload is decoded, so rejected dispatches cost almost nothing. Sequence number of rejected
+// dispatches is still tracked.
+//
+// READY and RESUMED are always delivered, as the gateway depends on them.
+type EventFilter interface {
+	Allow(event string) bool
+}
+
+// EventFilterFunc is a function implementing EventFilter. It is called from the read loop, so it has to be fast.
+type EventFilterFunc func(event string) bool
+
+func (f EventFilterFunc) Allow(event string) bool {
+	return f(event)
+}
+
+type eventSet struct {
+	names map[string]struct{}
+	allow bool
+}
+
+func (s eventSet) Allow(event string) bool {
+	_, ok := s.names[event]
+	return ok == s.allow
+}
+
+func newEventSet(allow bool, names []string) eventSet {
+	set := eventSet{names: make(map[string]struct{}, len(names)), allow: allow}
+	for _, name := range names {
+		set.names[name] = struct{}{}
+	}
+	return set
+}
+
+// AllowEvents creates EventFilter delivering only given dispatches.
+func AllowEvents(names ...string) EventFilter {
+	return newEventSet(true, names)
+}
+
+// DenyEvents creates EventFilter delivering all dispatches except the given ones.
+func DenyEvents(names ...string) EventFilter {
+	return newEventSet(false, names)
+}
+
+func allowEvent(filter EventFilter, event string) bool {
+	return filter == nil || event == "" || event == "READY" || event == "RESUMED" || filter.Allow(event)
+}
+
+// eventHeader holds top-level fields of the payload, read without decoding d.
+type eventHeader struct {
+	op    uint
+	event string
+	seq   uint64
+}
+
+// peekHeader scans top-level keys of the payload for op, t and s. Values of other keys (d) are skipped without
+// decoding, and scanning stops as soon as all three fields are found.
+func peekHeader(data []byte) (h eventHeader, ok bool) {
+	var found int
+	valid := scanObject(data, func(key, value []byte) bool {
+		switch string(key) {
+		case "op":
+			op, err := strconv.ParseUint(string(value), 10, 32)
+			if err != nil {
+				return false
+			}
+			h.op = uint(op)
+			found++
+		case "s":
+			if !bytes.Equal(value, []byte("null")) {
+				seq, err := strconv.ParseUint(string(value), 10, 64)
+				if err != nil {
+					return false
+				}
+				h.seq = seq
+			}
+			found++
+		case "t":
+			if !bytes.Equal(value, []byte("null")) {
+				// Event names never contain escapes, anything else is left for the decoder
+				if value[0] != '"' || bytes.IndexByte(value, '\\') != -1 {
+					return false
+				}
+				h.event = string(value[1 : len(value)-1])
+			}
+			found++
+		}
+		return found < 3
+	})
+	return h, valid && found == 3
+}
+
+// PeekIDs scans top-level keys of the dispatch payload (d) for snowflake fields (like guild_id) without decoding
+// the rest of it. Missing and null fields are 0. Scanning stops as soon as all fields are found.
+func PeekIDs(data []byte, keys ...string) (ids []snowflake.ID, ok bool) {
+	ids = make([]snowflake.ID, len(keys))
+	var found, invalid int
+	valid := scanObject(data, func(key, value []byte) bool {
+		i := slices.Index(keys, string(key))
+		if i == -1 {
+			return true
+		}
+		found++
+		if value = bytes.Trim(value, `"`); !bytes.Equal(value, []byte("null")) {
+			id, err := strconv.ParseUint(string(value), 10, 64)
+			if err != nil {
+				invalid++
+				return false
+			}
+			ids[i] = snowflake.ID(id)
+		}
+		return found < len(keys)
+	})
+	return ids, valid && invalid == 0
+}
+
+// scanObject calls fn with top-level keys and raw values of the JSON object, until fn returns false.
+// It reports whether the object was valid up to that point.
+func scanObject(data []byte, fn func(key, value []byte) bool) bool {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false
+	}
+	for i = skipSpace(data, i+1); i < len(data) && data[i] != '}'; {
+		end, ok := skipString(data, i)
+		if !ok {
+			return false
+		}
+		key := data[i+1 : end-1]
+		if i = skipSpace(data, end); i >= len(data) || data[i] != ':' {
+			return false
+		}
+		i = skipSpace(data, i+1)
+		if end, ok = skipValue(data, i); !ok {
+			return false
+		}
+		if !fn(key, data[i:end]) {
+			return true
+		}
+		if i = skipSpace(data, end); i < len(data) && data[i] == ',' {
+			i = skipSpace(data, i+1)
+		}
+	}
+	return i < len(data)
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\n' || data[i] == '\r' || data[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// skipString returns the index right after the string starting at i.
+func skipString(data []byte, i int) (int, bool) {
+	if i >= len(data) || data[i] != '"' {
+		return i, false
+	}
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, true
+		}
+	}
+	return i, false
+}
+
+// skipValue returns the index right after the value starting at i.
+func skipValue(data []byte, i int) (int, bool) {
+	if i >= len(data) {
+		return i, false
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for i < len(data) {
+			switch data[i] {
+			case '"':
+				end, ok := skipString(data, i)
+				if !ok {
+					return end, false
+				}
+				i = end
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1, true
+				}
+			}
+			i++
+		}
+		return i, false
+	}
+	start := i
+	for i < len(data) && data[i] != ',' && data[i] != '}' && data[i] != ']' && data[i] != ' ' && data[i] != '\n' && data[i] != '\r' && data[i] != '\t' {
+		i++
+	}
+	return i, i > start
+}
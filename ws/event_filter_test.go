@@ -0,0 +1,91 @@
+package ws
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/andersfylling/snowflake/v5"
+)
+
+func TestPeekIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []snowflake.ID
+		ok       bool
+	}{
+		{name: "both", data: `{"guild_id":"7","channel_id":"9"}`, expected: []snowflake.ID{7, 9}, ok: true},
+		{name: "null and missing", data: `{"id":"5","guild_id":null}`, expected: []snowflake.ID{0, 0}, ok: true},
+		{name: "nested keys", data: `{"channels":[{"guild_id":"1"}],"x":{"guild_id":"2"},"channel_id":"9"}`, expected: []snowflake.ID{0, 9}, ok: true},
+		{name: "escaped string", data: `{"content":"\"guild_id\":\"1\"","guild_id":"3"}`, expected: []snowflake.ID{3, 0}, ok: true},
+		{name: "invalid id", data: `{"guild_id":"x"}`, ok: false},
+		{name: "not an object", data: `[1]`, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ids, ok := PeekIDs([]byte(test.data), "guild_id", "channel_id")
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+			if ok && !slices.Equal(ids, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestPeekHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected eventHeader
+		ok       bool
+	}{
+		{name: "dispatch", data: `{"t":"MESSAGE_CREATE","s":5,"op":0,"d":{"t":"x","s":1}}`, expected: eventHeader{op: 0, event: "MESSAGE_CREATE", seq: 5}, ok: true},
+		{name: "data first", data: `{"d":{"content":"\"op\":1"},"op":0,"s":7,"t":"READY"}`, expected: eventHeader{op: 0, event: "READY", seq: 7}, ok: true},
+		{name: "null fields", data: `{"t":null,"s":null,"op":11,"d":null}`, expected: eventHeader{op: 11}, ok: true},
+		{name: "whitespace", data: " { \"op\" : 10 , \"d\" : { } , \"s\" : null , \"t\" : null } ", expected: eventHeader{op: 10}, ok: true},
+		{name: "missing field", data: `{"op":11}`, ok: false},
+		{name: "escaped event", data: `{"t":"A\u0042","s":1,"op":0}`, ok: false},
+		{name: "invalid op", data: `{"t":null,"s":null,"op":"x"}`, ok: false},
+		{name: "not an object", data: `[]`, ok: false},
+		{name: "truncated", data: `{"t":"READY","s":1`, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, ok := peekHeader([]byte(test.data))
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+			if ok && h != test.expected {
+				t.Fatalf("expected %+v, got %+v", test.expected, h)
+			}
+		})
+	}
+}
+
+func TestAllowEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   EventFilter
+		event    string
+		expected bool
+	}{
+		{name: "no filter", event: "MESSAGE_CREATE", expected: true},
+		{name: "allowed", filter: AllowEvents("MESSAGE_CREATE"), event: "MESSAGE_CREATE", expected: true},
+		{name: "not allowed", filter: AllowEvents("MESSAGE_CREATE"), event: "TYPING_START", expected: false},
+		{name: "denied", filter: DenyEvents("TYPING_START"), event: "TYPING_START", expected: false},
+		{name: "not denied", filter: DenyEvents("TYPING_START"), event: "MESSAGE_CREATE", expected: true},
+		{name: "ready", filter: AllowEvents(), event: "READY", expected: true},
+		{name: "resumed", filter: DenyEvents("RESUMED"), event: "RESUMED", expected: true},
+		{name: "not a dispatch", filter: AllowEvents(), event: "", expected: true},
+		{name: "func", filter: EventFilterFunc(func(event string) bool { return event == "A" }), event: "B", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed := allowEvent(test.filter, test.event); allowed != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, allowed)
+			}
+		})
+	}
+}
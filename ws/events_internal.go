@@ -11,16 +11,49 @@ type InternalEventAllocator interface {
 
 type InternalStatusChangeEvent Status
 
-// InternalConnectionClosed is sent when Gateway Status changes to StatusDisconnected
-type InternalConnectionClosed struct{}
+// InternalConnectionClosed is sent when Gateway Status changes to StatusDisconnected. Code is the close code received
+// from Discord or, if the connection was closed by the gateway itself, the code it sent. Err is the reason of closing,
+// it is nil when the connection was closed on request (Close, Disconnect, reconnect requested by Discord).
+type InternalConnectionClosed struct {
+	Code int
+	Err  error
+}
 
 type InternalHeartbeatEvent struct {
 	Start time.Time
 	End   time.Time
 }
 
+// InternalResumedEvent is sent after RESUMED dispatch, when all missed events were replayed
+type InternalResumedEvent struct {
+	Replayed int
+}
+
 type InternalDispatchEvent = *Event
 
 type InternalReadyEvent = *ReadyEvent
 
-type InternalMaxReconnectionLimitReached struct{}
+// InternalReconnectingEvent is sent before every reconnection attempt. Err is the error of the previous failed attempt.
+type InternalReconnectingEvent struct {
+	Attempt uint64
+	Delay   time.Duration
+	Err     error
+}
+
+// InternalReconnectGaveUpEvent is sent when ReconnectPolicy stops reconnecting. Gateway stays disconnected.
+type InternalReconnectGaveUpEvent struct {
+	Attempts uint64
+	Err      error
+}
+
+// InternalFatalErrorEvent is sent when Discord closes the connection with a fatal close code (see CloseError.Fatal).
+// Gateway does not reconnect after it.
+type InternalFatalErrorEvent struct {
+	Err error
+}
+
+// InternalReplayFinishedEvent is sent by the replay gateway after the last recorded event. Err is set if the recording is invalid.
+type InternalReplayFinishedEvent struct {
+	Events int
+	Err    error
+}
@@ -16,12 +16,11 @@ func (g *gatewayImpl) FetchMembers(ctx context.Context, params RequestGuildMembe
 	if g.Status() != StatusConnected {
 		return nil, nil, ErrGatewayNotConnected
 	}
-	g.sendEvent(sendEvent[RequestGuildMembersParams]{
-		OpCode: 8,
-		Data:   params,
-	})
-	events, close := g.Listen()
+	events, close := g.Listen(WithEvents("GUILD_MEMBERS_CHUNK"))
 	defer close()
+	if err = g.send(ctx, priorityNormal, 8, params); err != nil {
+		return nil, nil, fmt.Errorf("failed to request guild members: %w", err)
+	}
 	var (
 		members   []discord.MemberWithUser
 		presences []discord.Presence
@@ -41,7 +40,10 @@ loop:
 	for {
 	sel:
 		select {
-		case msg := <-events:
+		case msg, ok := <-events:
+			if !ok {
+				return members, presences, ErrGatewayNotConnected
+			}
 			if ev, ok := msg.(InternalDispatchEvent); ok {
 				if !timer.Stop() {
 					<-timer.C
@@ -1,10 +1,9 @@
 package ws
 
 import (
-	"bytes"
 	"context"
-	"errors"
 	"fmt"
+	"math/rand/v2"
 	"runtime"
 	"strings"
 	"sync"
@@ -13,6 +12,7 @@ import (
 
 	"github.com/BOOMfinity/go-utils/gpool"
 	"github.com/BOOMfinity/go-utils/inlineif"
+	"github.com/BOOMfinity/go-utils/rate"
 	"github.com/BOOMfinity/golog/v2"
 	"github.com/gorilla/websocket"
 	"github.com/segmentio/encoding/json"
@@ -21,33 +21,53 @@ import (
 	"github.com/BOOMfinity/bfcord/discord"
 )
 
-const maxReconnections = 3
+const closeCodeResumable = 4000
 
 var eventPool = gpool.New[Event]()
-var reconnectCodes = []int{4000, 4001, 4002, 4003, 4005, 4007, 4008, 4009}
 
 type Gateway interface {
-	Listen() (events <-chan any, cancel func())
+	// Listen registers a new event listener. Events are delivered in order; see ListenOption for buffering and filtering.
+	// Listener has to be cancelled when it is not needed anymore, channel is closed then.
+	Listen(opts ...ListenOption) (events <-chan any, cancel func())
+	// Send queues the payload with given opcode and waits until it is written to the connection.
+	//
+	// All sends share the limit of 120 messages per 60 seconds with some slots reserved for heartbeats.
+	// If ctx is done before the message is written, ErrSendExpired is returned. ErrSendDropped is returned when the connection is closed.
+	Send(ctx context.Context, op uint, data any) error
 	Disconnect()
+	// Close closes the connection without invalidating the session and saves it to Config.SessionStore.
+	Close() error
 	Connect(ctx context.Context) error
 	Config() Config
 	Status() Status
 	Log() golog.Logger
 	FetchMembers(ctx context.Context, params RequestGuildMembersParams) ([]discord.MemberWithUser, []discord.Presence, error)
+	UpdatePresence(ctx context.Context, presence PresenceUpdate) error
+	UpdateVoiceState(ctx context.Context, params UpdateVoiceStateParams) error
 }
 
 type gatewayImpl struct {
-	conn          *websocket.Conn
-	cfg           Config
-	session       string
-	resumeURL     string
-	seq           *atomic.Uint64
-	events        []chan<- any
+	conn      *websocket.Conn
+	cfg       Config
+	session   string
+	resumeURL string
+	seq       *atomic.Uint64
+	listeners []*listener
+	snapshot  []*listener
+	fanout    sync.Mutex
+	// queue holds events waiting for the fanout lock, in order they were sent
+	queue         []any
+	queueMut      sync.Mutex
 	mut           sync.RWMutex
 	log           golog.Logger
 	status        Status
-	buff          *bytes.Buffer
+	reader        *connReader
+	presence      *PresenceUpdate
+	sender        *sender
 	reconnections *atomic.Uint64
+	metrics       *gatewayMetrics
+	// cancelReconnect stops waiting for the pending reconnection attempt
+	cancelReconnect context.CancelFunc
 }
 
 func (g *gatewayImpl) Log() golog.Logger {
@@ -61,57 +81,18 @@ func (g *gatewayImpl) Status() Status {
 	return status
 }
 
-func (g *gatewayImpl) sendEvent(ev any) {
-	g.mut.RLock()
-	for _, ch := range g.events {
-		if allocator, ok := ev.(InternalEventAllocator); ok {
-			allocator.reference()
-		}
-		go func() {
-			ch <- ev
-		}()
-	}
-	g.mut.RUnlock()
+func (g *gatewayImpl) Send(ctx context.Context, op uint, data any) error {
+	return g.send(ctx, priorityNormal, op, data)
 }
 
-func (g *gatewayImpl) Listen() (events <-chan any, cancel func()) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		g.log.Trace().Send("Registering new event listener (%s:%d)", file, line)
-	}
-	ch := make(chan any, 1)
-	idx := -1
-
-	g.mut.Lock()
-	for i, v := range g.events {
-		if v == nil {
-			idx = i
-			break
-		}
-	}
-
-	if idx == -1 {
-		idx = len(g.events)
-		g.events = append(g.events, ch)
-	} else {
-		g.events[idx] = ch
-	}
-	g.mut.Unlock()
-
-	return ch, func() {
-		if idx == -1 {
-			return
-		}
-		g.mut.Lock()
-		defer g.mut.Unlock()
-		if len(g.events)-1 < idx {
-			return
-		}
-		if obj := g.events[idx]; obj != nil {
-			g.log.Trace().Send("Unregistering event listener (%s:%d)", file, line)
-			g.events[idx] = nil
-		}
+func (g *gatewayImpl) send(ctx context.Context, priority sendPriority, op uint, data any) error {
+	g.mut.RLock()
+	sender := g.sender
+	g.mut.RUnlock()
+	if sender == nil {
+		return ErrGatewayNotConnected
 	}
+	return sender.Send(ctx, priority, op, data)
 }
 
 func (g *gatewayImpl) changeStatus(status Status) {
@@ -124,41 +105,179 @@ func (g *gatewayImpl) changeStatus(status Status) {
 
 func (g *gatewayImpl) Disconnect() {
 	g.log.Warn().Send("Disconnect command received, closing the connection in FORCE mode")
-	g.disconnect(true, false)
+	g.stopReconnecting()
+	g.disconnect(nil, true, false)
+}
+
+func (g *gatewayImpl) Close() error {
+	g.log.Info().Send("Closing the connection, session stays resumable")
+	g.stopReconnecting()
+	g.disconnect(nil, false, false)
+	return g.saveSession()
+}
+
+func (g *gatewayImpl) saveSession() error {
+	if g.cfg.SessionStore == nil || g.session == "" {
+		return nil
+	}
+	err := g.cfg.SessionStore.Save(g.cfg.ID, SessionState{
+		SessionID:  g.session,
+		ResumeURL:  g.resumeURL,
+		Seq:        g.seq.Load(),
+		ShardCount: g.cfg.ShardCount,
+		SavedAt:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	g.log.Debug().Param("seq", g.seq.Load()).Send("Session saved")
+	return nil
 }
 
-func (g *gatewayImpl) disconnect(reset bool, reconnect bool) {
-	if g.status == StatusDisconnected {
+// restoreSession loads the session saved by the previous process. State is removed from the store,
+// so it is never used twice.
+func (g *gatewayImpl) restoreSession() {
+	state, ok, err := g.cfg.SessionStore.Load(g.cfg.ID)
+	if err != nil {
+		g.log.Error().Throw(fmt.Errorf("failed to load session: %w", err))
+		return
+	}
+	if !ok {
+		return
+	}
+	if err = g.cfg.SessionStore.Delete(g.cfg.ID); err != nil {
+		g.log.Error().Throw(err)
+	}
+	switch {
+	case state.SessionID == "" || state.ResumeURL == "":
+		g.log.Debug().Send("Saved session is incomplete, identifying")
+	case state.ShardCount != g.cfg.ShardCount:
+		g.log.Debug().Param("saved", state.ShardCount).Send("Saved session has different shard count, identifying")
+	case time.Since(state.SavedAt) > SessionResumeWindow:
+		g.log.Debug().Duration(time.Since(state.SavedAt)).Send("Saved session is too old, identifying")
+	default:
+		g.session = state.SessionID
+		g.resumeURL = state.ResumeURL
+		g.seq.Store(state.Seq)
+		g.log.Info().Param("seq", state.Seq).Send("Restored saved session")
+	}
+}
+
+// disconnect closes the connection. Cause is the error which made the gateway close it, nil if it was requested.
+func (g *gatewayImpl) disconnect(cause error, reset bool, reconnect bool) {
+	if g.Status() == StatusDisconnected {
 		return
 	}
-	g.sendEvent(InternalConnectionClosed{})
+	// Any code other than 1000 and 1001 keeps the session resumable
+	code := inlineif.IfElse(reset, websocket.CloseNormalClosure, closeCodeResumable)
+	if received := closeCodeOf(cause); received != 0 {
+		code = received
+	}
+	g.sendEvent(InternalConnectionClosed{Code: code, Err: cause})
 	g.log.Trace().Param("can-resume", !reset).Param("reconnect", reconnect).Send("Closing connection")
 	g.changeStatus(StatusDisconnected)
-	if g.conn != nil {
-		g.log.Trace().Send("Sending close frame as connection is not nil")
-		_ = g.conn.Close()
-	}
+	g.mut.Lock()
+	conn := g.conn
+	reader := g.reader
 	g.conn = nil
+	g.reader = nil
+	g.mut.Unlock()
+	if conn != nil {
+		g.log.Trace().Param("code", code).Send("Sending close frame as connection is not nil")
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		_ = conn.Close()
+	}
+	if reader != nil {
+		reader.Close()
+	}
+	g.mut.Lock()
+	if g.sender != nil {
+		g.sender.Close()
+		g.sender = nil
+	}
+	g.mut.Unlock()
 	if reset {
 		g.reset()
 	}
-	g.buff.Reset()
 
 	if reconnect {
-		if g.reconnections.Load() >= maxReconnections {
-			g.log.Warn().Send("Max reconnections reached, next reconnection will be in 5 minutes")
-			g.sendEvent(InternalMaxReconnectionLimitReached{})
-			time.Sleep(5 * time.Minute)
+		g.reconnect(0, nil)
+	}
+}
+
+// reconnect schedules the next reconnection attempt according to Config.ReconnectPolicy. The attempt waits at least
+// the given delay. Cause is the error of the previous failed attempt.
+func (g *gatewayImpl) reconnect(delay time.Duration, cause error) {
+	attempt := g.reconnections.Add(1)
+	wait, ok := g.cfg.ReconnectPolicy.Delay(attempt)
+	if !ok {
+		g.log.Error().Param("attempts", attempt-1).Send("Reconnect policy gave up, gateway stays disconnected")
+		g.sendEvent(InternalReconnectGaveUpEvent{Attempts: attempt - 1, Err: cause})
+		return
+	}
+	g.metrics.reconnecting()
+	wait = max(wait, delay)
+	ctx, cancel := context.WithCancel(context.Background())
+	g.mut.Lock()
+	if g.cancelReconnect != nil {
+		g.cancelReconnect()
+	}
+	g.cancelReconnect = cancel
+	g.mut.Unlock()
+	g.changeStatus(StatusReconnecting)
+	g.sendEvent(InternalReconnectingEvent{Attempt: attempt, Delay: wait, Err: cause})
+	go func() {
+		defer cancel()
+		if wait > 0 {
+			g.log.Debug().Param("attempt", attempt).Send("Reconnecting in %s", wait)
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				g.log.Debug().Param("attempt", attempt).Send("Reconnection cancelled")
+				return
+			}
 		}
-		go func() {
-			g.reconnections.Add(1)
-			if err := g.Connect(context.Background()); err != nil {
-				g.log.Error().Throw(fmt.Errorf("could not reconnect: %w", err))
+		if err := g.Connect(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			g.log.Error().Throw(fmt.Errorf("could not reconnect: %w", err))
+			if closeAction(err) == CloseActionFatal {
+				g.sendEvent(InternalFatalErrorEvent{Err: err})
+				return
 			}
-		}()
+			g.reconnect(0, err)
+		}
+	}()
+}
+
+// fail closes the connection that failed with err. Depending on the close code, session is resumed, a new one
+// is created or the gateway stays disconnected.
+func (g *gatewayImpl) fail(err error) {
+	switch closeAction(err) {
+	case CloseActionFatal:
+		g.log.Error().Send("Connection closed with fatal code, gateway will not reconnect")
+		g.stopReconnecting()
+		g.disconnect(err, true, false)
+		g.sendEvent(InternalFatalErrorEvent{Err: err})
+	case CloseActionReidentify:
+		g.disconnect(err, true, true)
+	default:
+		g.disconnect(err, false, true)
 	}
 }
 
+func (g *gatewayImpl) stopReconnecting() {
+	g.mut.Lock()
+	if g.cancelReconnect != nil {
+		g.cancelReconnect()
+		g.cancelReconnect = nil
+	}
+	g.mut.Unlock()
+}
+
 func (g *gatewayImpl) reset() {
 	g.log.Trace().Send("Resetting session data")
 	g.resumeURL = ""
@@ -166,61 +285,73 @@ func (g *gatewayImpl) reset() {
 	g.seq = &atomic.Uint64{}
 }
 
-func (g *gatewayImpl) read() (*Event, error) {
-	g.buff.Reset()
-	messageType, reader, err := g.conn.NextReader()
+func (g *gatewayImpl) read(r *connReader) (*Event, error) {
+	ev, err := r.read()
 	if err != nil {
-		var closed *websocket.CloseError
-		if errors.As(err, &closed) {
-			g.log.Warn().
-				Param("code", closed.Code).
-				Param("reason", closed.Text).
-				Send("Connection closed")
-			defer g.disconnect(false, true)
-			return nil, fmt.Errorf("connection closed: %w", err)
-		}
-		return nil, fmt.Errorf("unexpected error: %w", err)
+		return nil, err
 	}
-	ev := eventPool.Get()
-	if messageType == websocket.BinaryMessage {
-		panic("not implemented")
-	} else {
-		_, err = g.buff.ReadFrom(reader)
-		if err != nil {
-			return nil, fmt.Errorf("error reading from connection reader: %w", err)
-		}
-		if err = json.Unmarshal(g.buff.Bytes(), ev); err != nil {
-			return nil, fmt.Errorf("error unmarshalling event: %w", err)
+	g.metrics.event(ev)
+	for ev.filtered {
+		g.record(ev)
+		g.seq.Store(ev.Seq)
+		g.metrics.filteredEvent(ev)
+		ev.free()
+		if ev, err = r.read(); err != nil {
+			return nil, err
 		}
+		g.metrics.event(ev)
 	}
-	{
-		msg := g.log.Trace().
-			Param("op", ev.OpCode)
-		if ev.Event != "" {
-			msg.Param("event", ev.Event)
-		}
-		if len(ev.Data) > 0 {
-			if len(ev.Data) > 1024*1024 {
-				msg.Param("size", fmt.Sprintf("%dMiB", len(ev.Data)/1024/1024))
-			} else if len(ev.Data) > 1024 {
-				msg.Param("size", fmt.Sprintf("%dKiB", len(ev.Data)/1024))
-			} else {
-				msg.Param("size", fmt.Sprintf("%dB", len(ev.Data)))
-			}
-		}
-		msg.Param("seq", ev.Seq).Send("Got message from Discord")
+	g.record(ev)
+	// Only dispatches carry the sequence number, other opcodes have it set to null
+	if ev.OpCode == 0 && ev.Seq != 0 {
+		g.seq.Store(ev.Seq)
 	}
-	g.seq.Store(ev.Seq)
 	return ev, nil
 }
 
+// record saves the event with Config.Recorder. Data of filtered dispatches is not read, so only their header is saved.
+func (g *gatewayImpl) record(ev *Event) {
+	if g.cfg.Recorder == nil {
+		return
+	}
+	err := g.cfg.Recorder.Record(g.cfg.ID, RecordedEvent{
+		OpCode:     ev.OpCode,
+		Event:      ev.Event,
+		Seq:        ev.Seq,
+		Data:       inlineif.IfElse(ev.filtered, nil, ev.Data),
+		Filtered:   ev.filtered,
+		ReceivedAt: time.Now(),
+	})
+	if err != nil {
+		g.log.Error().Throw(fmt.Errorf("failed to record event: %w", err))
+	}
+}
+
 func (g *gatewayImpl) startHeartbeat(dur time.Duration) {
 	log := g.log.Module("heartbeat")
 	log.Trace().Send("Initializing")
-	listener, cancel := g.Listen()
+	listener, cancel := g.Listen(WithFilter(func(ev any) bool {
+		data, ok := ev.(InternalDispatchEvent)
+		return !ok || data.OpCode != 0
+	}))
 	defer cancel()
-	timer := time.NewTimer(dur)
-	bench := golog.CreateBenchmarkContext()
+	// The first heartbeat is sent after interval * jitter, so shards do not heartbeat at the same time
+	timer := time.NewTimer(rand.N(dur))
+	defer timer.Stop()
+	acked := true
+	var sentAt time.Time
+	heartbeat := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dur)
+		err := g.send(ctx, priorityHeartbeat, 1, g.seq.Load())
+		cancel()
+		if err != nil {
+			log.Error().Throw(fmt.Errorf("failed to send heartbeat: %w", err))
+			return
+		}
+		acked = false
+		sentAt = time.Now()
+		log.Trace().Send("Sent, ACK should be in milliseconds...")
+	}
 	for {
 		select {
 		case raw, ok := <-listener:
@@ -233,32 +364,40 @@ func (g *gatewayImpl) startHeartbeat(dur time.Duration) {
 				log.Trace().Send("Closing heartbeat, connection closed")
 				return
 			case InternalDispatchEvent:
-				if data.OpCode == 11 {
-					log.Scope("ACK").Debug().Duration(bench.Elapsed()).Send("Received heartbeat response")
+				switch data.OpCode {
+				case 11:
+					acked = true
+					if !sentAt.IsZero() {
+						now := time.Now()
+						log.Scope("ACK").Debug().Duration(now.Sub(sentAt)).Send("Received heartbeat response")
+						g.metrics.latency(now.Sub(sentAt))
+						g.sendEvent(InternalHeartbeatEvent{Start: sentAt, End: now})
+					}
+				case 1:
+					log.Debug().Send("Discord requested a heartbeat")
+					heartbeat()
 				}
+				data.Dereference()
 			}
 		case <-timer.C:
 			timer.Reset(dur)
-			if err := g.conn.WriteJSON(sendEvent[uint64]{
-				OpCode: 1,
-				Data:   g.seq.Load(),
-			}); err != nil {
-				g.log.Error().Throw(fmt.Errorf("failed to send message to Discord: %w", err))
-				break
+			if !acked {
+				log.Warn().Param("last-sent", sentAt).Send("Heartbeat ACK was not received, connection is zombied. Reconnecting")
+				g.disconnect(ErrHeartbeatTimeout, false, true)
+				return
 			}
-			bench.Update()
-			log.Trace().Send("Sent, ACK should be in milliseconds...")
+			heartbeat()
 		}
 	}
 }
 
-func (g *gatewayImpl) handshake(resume bool) error {
+func (g *gatewayImpl) handshake(ctx context.Context, r *connReader, resume bool) error {
 	var (
 		hello HelloOp
 		ready ReadyEvent
 	)
 	{
-		ev, err := g.read()
+		ev, err := g.read(r)
 		if err != nil {
 			return fmt.Errorf("could not read hello op: %w", err)
 		}
@@ -272,22 +411,25 @@ func (g *gatewayImpl) handshake(resume bool) error {
 	}
 	if !resume {
 		g.log.Trace().Send("That's new connection, sending Identify OP (2)")
-		_ = g.conn.WriteJSON(sendEvent[Identify]{
-			OpCode: 2,
-			Data: Identify{
-				Token: g.cfg.Token,
-				Properties: IdentifyProperties{
-					OS:      runtime.GOOS,
-					Browser: "bfcord v0.0.1",
-					Device:  "bfcord v0.0.1",
-				},
-				Compress: false,
-				Shard:    []uint16{g.cfg.ID, g.cfg.ShardCount},
-				Intents:  g.cfg.Intents,
+		g.mut.RLock()
+		presence := g.presence
+		g.mut.RUnlock()
+		if err := g.send(ctx, priorityHandshake, 2, Identify{
+			Token: g.cfg.Token,
+			Properties: IdentifyProperties{
+				OS:      runtime.GOOS,
+				Browser: "bfcord v0.0.1",
+				Device:  "bfcord v0.0.1",
 			},
-		})
+			Compress: false,
+			Shard:    []uint16{g.cfg.ID, g.cfg.ShardCount},
+			Intents:  g.cfg.Intents,
+			Presence: presence,
+		}); err != nil {
+			return fmt.Errorf("could not send identify: %w", err)
+		}
 		{
-			ev, err := g.read()
+			ev, err := g.read(r)
 			if err != nil {
 				return fmt.Errorf("could not read ready event: %w", err)
 			}
@@ -309,42 +451,76 @@ func (g *gatewayImpl) handshake(resume bool) error {
 			g.resumeURL = ready.ResumeGatewayURL
 			g.session = ready.SessionID
 			g.mut.Unlock()
+			g.metrics.identified()
 			g.sendEvent((InternalDispatchEvent)(ev))
 		}
 	} else {
-		g.log.Trace().Send("Trying to resume the session")
-		_ = g.conn.WriteJSON(sendEvent[resumeEvent]{
-			OpCode: 6,
-			Data: resumeEvent{
-				Token:     g.cfg.Token,
-				Seq:       g.seq.Load(),
-				SessionID: g.session,
-			},
-		})
-		ev, err := g.read()
-		if err != nil {
-			return fmt.Errorf("could not read resume event: %w", err)
+		g.log.Trace().Param("seq", g.seq.Load()).Send("Trying to resume the session")
+		// Missed dispatches are replayed before RESUMED, so they are read by the event loop instead of here.
+		// The status must be changed before the loop starts, otherwise RESUMED could be missed.
+		g.changeStatus(StatusResuming)
+		if err := g.send(ctx, priorityHandshake, 6, resumeEvent{
+			Token:     g.cfg.Token,
+			Seq:       g.seq.Load(),
+			SessionID: g.session,
+		}); err != nil {
+			return fmt.Errorf("could not send resume: %w", err)
 		}
-		if ev.OpCode != 7 {
-			return fmt.Errorf("unexpected op code %d (wanted 7)", ev.OpCode)
-		}
-		g.log.Trace().Send("Received Resume OP (7), ready to read events")
 	}
 	g.log.Trace().Send("Starting event loop and heartbeat goroutines")
-	go g.readEventsForever()
+	go g.readEventsForever(r)
 	go g.startHeartbeat(time.Duration(hello.HeartbeatInterval) * time.Millisecond)
 	return nil
 }
 
-func (g *gatewayImpl) readEventsForever() {
+func (g *gatewayImpl) readEventsForever(r *connReader) {
+	var replayed int
 	for {
-		ev, err := g.read()
+		ev, err := g.read(r)
 		if err != nil {
-			if g.Status() == StatusDisconnected {
+			g.mut.RLock()
+			stale := g.reader != r
+			g.mut.RUnlock()
+			if stale || g.Status() == StatusDisconnected {
 				return
 			}
 			g.log.Error().Throw(fmt.Errorf("could not read event: %w", err))
-			g.disconnect(false, true)
+			g.fail(err)
+			return
+		}
+		switch ev.OpCode {
+		case 0:
+			if g.Status() != StatusResuming {
+				break
+			}
+			if ev.Event != "RESUMED" {
+				replayed++
+				break
+			}
+			g.log.Info().Param("replayed", replayed).Send("Session resumed")
+			g.changeStatus(StatusConnected)
+			g.reconnections.Store(0)
+			g.metrics.resumed()
+			g.sendEvent(InternalResumedEvent{Replayed: replayed})
+			go func() {
+				if err := g.sendPresence(context.Background()); err != nil {
+					g.log.Error().Throw(err)
+				}
+			}()
+		case 7:
+			g.log.Info().Send("Discord requested reconnect (op 7), resuming the session")
+			ev.free()
+			g.disconnect(nil, false, true)
+			return
+		case 9:
+			var resumable bool
+			_ = json.Unmarshal(ev.Data, &resumable)
+			ev.free()
+			// Discord requires waiting a random time between 1 and 5 seconds before identifying again
+			delay := time.Second + rand.N(4*time.Second)
+			g.log.Warn().Param("resumable", resumable).Send("Session invalidated by Discord (op 9)")
+			g.disconnect(nil, !resumable, false)
+			g.reconnect(delay, nil)
 			return
 		}
 		g.sendEvent((InternalDispatchEvent)(ev))
@@ -355,20 +531,32 @@ func (g *gatewayImpl) Connect(ctx context.Context) error {
 	g.log.Trace().Send("Preparing to connect to the '%s'", g.Config().URL)
 	if g.conn != nil {
 		g.log.Trace().Send("Connection was not closed, closing before connecting")
-		g.disconnect(true, false)
-		_ = g.conn.Close()
+		g.disconnect(nil, true, false)
 	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	if g.session == "" && g.cfg.SessionStore != nil {
+		g.restoreSession()
+	}
 	url := inlineif.IfElse(g.resumeURL == "", g.Config().URL, g.resumeURL)
 	url += "?v=" + strings.TrimLeft(bfcord.APIVersion, "v")
-	if g.cfg.Compression {
-		url += "&compress=zlib-stream"
+	if g.cfg.Encoding != nil {
+		url += "&encoding=" + g.cfg.Encoding.Name()
+	} else {
+		url += "&encoding=json"
 	}
-	if g.cfg.GlobalLimiter != nil && g.resumeURL == "" {
+	if g.cfg.Compression != CompressionNone {
+		url += "&compress=" + string(g.cfg.Compression)
+	}
+	if g.cfg.IdentifyLimiter != nil && g.resumeURL == "" {
+		g.log.Trace().Send("Using identify limiter")
+		if err := g.cfg.IdentifyLimiter.Wait(ctx, g.cfg.ID); err != nil {
+			return fmt.Errorf("failed to wait for identify limiter: %w", err)
+		}
+	} else if g.cfg.GlobalLimiter != nil && g.resumeURL == "" {
 		g.log.Trace().Send("Using identify global limiter")
-		if err := g.cfg.GlobalLimiter.Wait(ctx); err != nil {
+		if err := waitLimiter(ctx, g.cfg.GlobalLimiter); err != nil {
 			return fmt.Errorf("failed to wait for identify rate limiter: %w", err)
 		}
 	}
@@ -377,18 +565,43 @@ func (g *gatewayImpl) Connect(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("could not connect to the %s: %w", g.Config().URL, err)
 	}
+	reader := newConnReader(conn, g.cfg, g.log, g.metrics)
+	g.mut.Lock()
 	g.conn = conn
+	g.reader = reader
+	g.sender = newSender(conn, g.cfg.Encoding, g.log.Module("sender"), g.metrics)
+	g.mut.Unlock()
 	g.log.Trace().Send("Connection successfully created, handshaking with Discord Gateway")
 	g.changeStatus(StatusConnecting)
-	if err = g.handshake(g.resumeURL != ""); err != nil {
-		g.disconnect(true, true)
+	resume := g.resumeURL != ""
+	if err = g.handshake(ctx, reader, resume); err != nil {
+		g.disconnect(err, true, false)
 		return fmt.Errorf("error while handshaking: %w", err)
 	}
-	g.changeStatus(StatusConnected)
-	g.reconnections.Store(0)
+	// Resumed session becomes connected after RESUMED dispatch
+	if !resume {
+		g.changeStatus(StatusConnected)
+		g.reconnections.Store(0)
+	}
 	return nil
 }
 
+// waitLimiter waits for the limiter until ctx is done. Limiter stops working when its Wait is cancelled
+// (the slot is never taken), so the slot is always taken in the background and wasted if ctx is done first.
+func waitLimiter(ctx context.Context, limiter *rate.Limiter) error {
+	done := make(chan struct{})
+	go func() {
+		_ = limiter.Wait(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (g *gatewayImpl) Config() Config {
 	return g.cfg
 }
@@ -400,13 +613,17 @@ func NewGateway(cfg Config) Gateway {
 	if cfg.Intents == 0 {
 		cfg.Intents = GatewayIntentDefault
 	}
+	if cfg.ReconnectPolicy == nil {
+		cfg.ReconnectPolicy = DefaultReconnectPolicy
+	}
 	gtw := new(gatewayImpl)
 	gtw.log = cfg.Logger.Scope(fmt.Sprint(cfg.ID))
 	gtw.cfg = cfg
-	gtw.buff = bytes.NewBuffer(make([]byte, 0, 1024*1024))
+	gtw.presence = cfg.Presence
 	gtw.reset()
 	gtw.status = StatusDisconnected
 	gtw.reconnections = &atomic.Uint64{}
+	gtw.metrics = newGatewayMetrics(cfg.Metrics, cfg.ID)
 	gtw.log.Trace().Send("Gateway instance created")
 	return gtw
 }
@@ -0,0 +1,296 @@
+package ws_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+
+	"github.com/BOOMfinity/bfcord/ws"
+	"github.com/BOOMfinity/bfcord/ws/wstest"
+)
+
+const testToken = "token"
+
+// testLogger discards logs. Color engine of golog reuses its buffers concurrently, which is reported by the race detector.
+var testLogger = golog.NewCustom("test", func(golog.Message) {})
+
+// connect creates the gateway connected to srv. Returned listener receives all events of the gateway.
+func connect(t *testing.T, srv *wstest.Server, token string) (ws.Gateway, <-chan any, error) {
+	t.Helper()
+	gtw := ws.NewGateway(ws.Config{
+		URL:        srv.URL(),
+		Token:      token,
+		ShardCount: 1,
+		// Gateway scopes the logger in place, so every gateway needs its own copy
+		Logger:          testLogger.Module("gateway"),
+		ReconnectPolicy: ws.NewBackoffPolicy(10*time.Millisecond, 50*time.Millisecond, 0),
+	})
+	events, cancel := gtw.Listen(ws.WithBuffer(256), ws.WithOverflow(ws.OverflowDropOldest))
+	t.Cleanup(func() {
+		gtw.Disconnect()
+		cancel()
+	})
+	return gtw, events, gtw.Connect(testContext(t))
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// waitEvent returns the first event of type T matching fn.
+func waitEvent[T any](t *testing.T, events <-chan any, fn func(ev T) bool) T {
+	t.Helper()
+	ctx := testContext(t)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("listener closed before %T was received", *new(T))
+			}
+			if data, ok := ev.(T); ok && (fn == nil || fn(data)) {
+				return data
+			}
+		case <-ctx.Done():
+			t.Fatalf("%T was not received", *new(T))
+		}
+	}
+}
+
+func isDispatch(name string) func(ev ws.InternalDispatchEvent) bool {
+	return func(ev ws.InternalDispatchEvent) bool {
+		return ev.OpCode == 0 && ev.Event == name
+	}
+}
+
+func TestGatewayResume(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	_, events, err := connect(t, srv, testToken)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if err = srv.CloseShard(0, 4000, "unknown error"); err != nil {
+		t.Fatalf("failed to close shard: %s", err)
+	}
+	// Missed event is stored by the server and replayed on resume
+	if err = srv.Dispatch(0, "TYPING_START", map[string]any{"channel_id": "1"}); err != nil {
+		t.Fatalf("failed to dispatch: %s", err)
+	}
+	if _, err = srv.WaitFor(testContext(t), wstest.Op(6)); err != nil {
+		t.Fatalf("resume was not sent: %s", err)
+	}
+	waitEvent(t, events, isDispatch("TYPING_START"))
+	resumed := waitEvent[ws.InternalResumedEvent](t, events, nil)
+	if resumed.Replayed != 1 {
+		t.Fatalf("expected 1 replayed event, got %d", resumed.Replayed)
+	}
+}
+
+func TestGatewayFatalCloseCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []wstest.ServerOption
+		token    string
+		close    int
+		expected error
+	}{
+		{name: "4004 on identify", opts: []wstest.ServerOption{wstest.WithToken(testToken)}, token: "invalid", expected: ws.ErrCloseAuthenticationFailed},
+		{name: "4014 on identify", opts: []wstest.ServerOption{wstest.WithDisallowedIntents(ws.GatewayIntentDefault)}, token: testToken, expected: ws.ErrCloseDisallowedIntents},
+		{name: "4004 after connect", token: testToken, close: 4004, expected: ws.ErrCloseAuthenticationFailed},
+		{name: "4014 after connect", token: testToken, close: 4014, expected: ws.ErrCloseDisallowedIntents},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := wstest.NewServer(test.opts...)
+			defer srv.Close()
+			gtw, events, err := connect(t, srv, test.token)
+			if test.close == 0 {
+				if !errors.Is(err, test.expected) {
+					t.Fatalf("expected %v, got %v", test.expected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to connect: %s", err)
+			}
+			if err = srv.CloseShard(0, test.close, ""); err != nil {
+				t.Fatalf("failed to close shard: %s", err)
+			}
+			fatal := waitEvent[ws.InternalFatalErrorEvent](t, events, nil)
+			if !errors.Is(fatal.Err, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, fatal.Err)
+			}
+			// Gateway does not reconnect after fatal close codes
+			time.Sleep(100 * time.Millisecond)
+			if status := gtw.Status(); status != ws.StatusDisconnected {
+				t.Fatalf("expected disconnected gateway, got %s", status)
+			}
+		})
+	}
+}
+
+func TestGatewayZombieConnection(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken), wstest.WithHeartbeatInterval(50*time.Millisecond))
+	defer srv.Close()
+	srv.SetHeartbeatACK(false)
+	_, events, err := connect(t, srv, testToken)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	closed := waitEvent[ws.InternalConnectionClosed](t, events, nil)
+	if !errors.Is(closed.Err, ws.ErrHeartbeatTimeout) {
+		t.Fatalf("expected heartbeat timeout, got %v", closed.Err)
+	}
+	srv.SetHeartbeatACK(true)
+	if _, err = srv.WaitFor(testContext(t), wstest.Op(6)); err != nil {
+		t.Fatalf("zombie connection was not resumed: %s", err)
+	}
+	waitEvent[ws.InternalResumedEvent](t, events, nil)
+}
+
+func TestGatewayZombieConnectionBlockedListener(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken), wstest.WithHeartbeatInterval(50*time.Millisecond))
+	defer srv.Close()
+	gtw, _, err := connect(t, srv, testToken)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	// Listener with default options, which does not receive anything, blocks the connection reader,
+	// so heartbeat ACKs are not read
+	blocked, cancel := gtw.Listen(ws.WithBuffer(0))
+	defer cancel()
+	if err = srv.Dispatch(0, "MESSAGE_CREATE", map[string]any{"id": "1"}); err != nil {
+		t.Fatalf("failed to dispatch message: %s", err)
+	}
+	if _, err = srv.WaitFor(testContext(t), wstest.Op(6)); err != nil {
+		t.Fatalf("zombie connection was not resumed: %s", err)
+	}
+	waitEvent[ws.InternalResumedEvent](t, blocked, nil)
+}
+
+func TestGatewayReconnectRequest(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	_, events, err := connect(t, srv, testToken)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if err = srv.RequestReconnect(0); err != nil {
+		t.Fatalf("failed to request reconnect: %s", err)
+	}
+	if _, err = srv.WaitFor(testContext(t), wstest.Op(6)); err != nil {
+		t.Fatalf("session was not resumed after op 7: %s", err)
+	}
+	waitEvent[ws.InternalResumedEvent](t, events, nil)
+}
+
+func TestGatewayInvalidSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		resumable bool
+		expected  uint
+	}{
+		{name: "resumable", resumable: true, expected: 6},
+		{name: "not resumable", resumable: false, expected: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			srv := wstest.NewServer(wstest.WithToken(testToken))
+			defer srv.Close()
+			_, events, err := connect(t, srv, testToken)
+			if err != nil {
+				t.Fatalf("failed to connect: %s", err)
+			}
+			if _, err = srv.WaitFor(testContext(t), wstest.Op(2)); err != nil {
+				t.Fatalf("identify was not received: %s", err)
+			}
+			waitEvent(t, events, isDispatch("READY"))
+			if err = srv.InvalidateSession(0, test.resumable); err != nil {
+				t.Fatalf("failed to invalidate session: %s", err)
+			}
+			// Identify and resume are sent after 1-5 seconds
+			p, err := srv.WaitFor(testContext(t), func(p wstest.Payload) bool {
+				return p.OpCode == 2 || p.OpCode == 6
+			})
+			if err != nil {
+				t.Fatalf("gateway did not reconnect: %s", err)
+			}
+			if p.OpCode != test.expected {
+				t.Fatalf("expected op %d, got %d", test.expected, p.OpCode)
+			}
+			if test.resumable {
+				waitEvent[ws.InternalResumedEvent](t, events, nil)
+			} else {
+				waitEvent(t, events, isDispatch("READY"))
+			}
+		})
+	}
+}
+
+type memoryRecorder struct {
+	mut    sync.Mutex
+	events []ws.RecordedEvent
+}
+
+func (r *memoryRecorder) Record(_ uint16, ev ws.RecordedEvent) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	ev.Data = slices.Clone(ev.Data)
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *memoryRecorder) Close() error {
+	return nil
+}
+
+func TestGatewayRecordFiltered(t *testing.T) {
+	srv := wstest.NewServer(wstest.WithToken(testToken))
+	defer srv.Close()
+	recorder := new(memoryRecorder)
+	gtw := ws.NewGateway(ws.Config{
+		URL:         srv.URL(),
+		Token:       testToken,
+		ShardCount:  1,
+		Logger:      testLogger.Module("gateway"),
+		Recorder:    recorder,
+		EventFilter: ws.DenyEvents("TYPING_START"),
+	})
+	events, cancel := gtw.Listen(ws.WithBuffer(256))
+	defer cancel()
+	defer gtw.Disconnect()
+	if err := gtw.Connect(testContext(t)); err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	for _, event := range []string{"TYPING_START", "MESSAGE_CREATE"} {
+		if err := srv.Dispatch(0, event, map[string]any{"channel_id": "1"}); err != nil {
+			t.Fatalf("failed to dispatch %s: %s", event, err)
+		}
+	}
+	waitEvent(t, events, isDispatch("MESSAGE_CREATE")).Dereference()
+
+	recorder.mut.Lock()
+	defer recorder.mut.Unlock()
+	var recorded []string
+	for _, ev := range recorder.events {
+		if ev.OpCode != 0 || ev.Event == "READY" {
+			continue
+		}
+		if ev.Filtered && len(ev.Data) > 0 {
+			t.Fatalf("data of filtered %s was recorded", ev.Event)
+		}
+		recorded = append(recorded, fmt.Sprintf("%s %d %v", ev.Event, ev.Seq, ev.Filtered))
+	}
+	if expected := []string{"TYPING_START 2 true", "MESSAGE_CREATE 3 false"}; !slices.Equal(recorded, expected) {
+		t.Fatalf("expected %q, got %q", expected, recorded)
+	}
+}
@@ -0,0 +1,16 @@
+package ws
+
+import "context"
+
+// IdentifyLimiter decides when the shard can identify. It is used to share the identify concurrency
+// between processes of the bot.
+type IdentifyLimiter interface {
+	Wait(ctx context.Context, shard uint16) error
+}
+
+// IdentifyLimiterFunc is a function implementing IdentifyLimiter.
+type IdentifyLimiterFunc func(ctx context.Context, shard uint16) error
+
+func (f IdentifyLimiterFunc) Wait(ctx context.Context, shard uint16) error {
+	return f(ctx, shard)
+}
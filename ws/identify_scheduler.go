@@ -0,0 +1,131 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+)
+
+const (
+	// identifyInterval is the time between identifies of the same bucket (5 seconds required by Discord with a margin).
+	identifyInterval = 5250 * time.Millisecond
+	// sessionStartPeriod is the time after which the session start limit is reset.
+	sessionStartPeriod = 24 * time.Hour
+)
+
+type IdentifySchedulerOption func(s *IdentifyScheduler)
+
+// WithSessionStartLimit makes the scheduler track the session start limit (see GET /gateway/bot). Remaining session
+// starts decrease with every identify and are restored to total when resetAfter passes.
+func WithSessionStartLimit(total, remaining int, resetAfter time.Duration) IdentifySchedulerOption {
+	return func(s *IdentifyScheduler) {
+		s.total = total
+		s.remaining = remaining
+		s.resetAt = time.Now().Add(resetAfter)
+	}
+}
+
+// WaitForSessionStartReset makes identifies wait for the reset of the session start limit, instead of failing
+// with ErrSessionStartLimit when it is exhausted.
+func WaitForSessionStartReset() IdentifySchedulerOption {
+	return func(s *IdentifyScheduler) {
+		s.waitReset = true
+	}
+}
+
+// IdentifyScheduler is IdentifyLimiter following the identify rules of Discord. Shards are split into
+// max_concurrency buckets (shard_id % max_concurrency), every bucket identifies once per 5 seconds, and shards
+// of the same bucket identify in the order of Wait calls.
+type IdentifyScheduler struct {
+	log       golog.Logger
+	waitReset bool
+
+	mut sync.Mutex
+	// buckets hold the time, when the next identify of the bucket is allowed
+	buckets   []time.Time
+	total     int
+	remaining int
+	resetAt   time.Time
+}
+
+// Wait reserves the next identify slot of the shard bucket and waits for it. If ctx is done first, the slot is
+// wasted, but the session start is given back.
+func (s *IdentifyScheduler) Wait(ctx context.Context, shard uint16) error {
+	s.mut.Lock()
+	now := time.Now()
+	bucket := int(shard) % len(s.buckets)
+	at := s.buckets[bucket]
+	if at.Before(now) {
+		at = now
+	}
+	resetAt := s.resetAt
+	if s.total > 0 {
+		if !at.Before(s.resetAt) {
+			s.restore(at)
+		}
+		if s.remaining <= 0 {
+			if !s.waitReset {
+				s.mut.Unlock()
+				return fmt.Errorf("%w: resets in %s", ErrSessionStartLimit, s.resetAt.Sub(now).Round(time.Second))
+			}
+			at = s.resetAt
+			s.restore(at)
+			s.log.Warn().Param("shard", shard).Send("Session start limit is exhausted, identifying at %s", at.Format(time.DateTime))
+		}
+		s.remaining--
+		resetAt = s.resetAt
+	}
+	s.buckets[bucket] = at.Add(identifyInterval)
+	s.mut.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		s.mut.Lock()
+		if s.total > 0 && s.resetAt.Equal(resetAt) {
+			s.remaining++
+		}
+		s.mut.Unlock()
+		return ctx.Err()
+	}
+}
+
+// restore resets the session start limit at the given time. It must be called with mut held.
+func (s *IdentifyScheduler) restore(at time.Time) {
+	s.remaining = s.total
+	for !at.Before(s.resetAt) {
+		s.resetAt = s.resetAt.Add(sessionStartPeriod)
+	}
+}
+
+// Remaining returns the number of session starts left and the time of the limit reset. It is -1 when the limit
+// is not tracked.
+func (s *IdentifyScheduler) Remaining() (int, time.Time) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.total <= 0 {
+		return -1, time.Time{}
+	}
+	if !time.Now().Before(s.resetAt) {
+		s.restore(time.Now())
+	}
+	return s.remaining, s.resetAt
+}
+
+// NewIdentifyScheduler creates IdentifyScheduler for the max_concurrency of the bot (see GET /gateway/bot).
+func NewIdentifyScheduler(log golog.Logger, maxConcurrency int, opts ...IdentifySchedulerOption) *IdentifyScheduler {
+	s := &IdentifyScheduler{
+		log:     log,
+		buckets: make([]time.Time, max(maxConcurrency, 1)),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
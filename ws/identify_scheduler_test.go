@@ -0,0 +1,79 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+)
+
+var testLogger = golog.NewCustom("test", func(golog.Message) {})
+
+func TestIdentifySchedulerBuckets(t *testing.T) {
+	s := NewIdentifyScheduler(testLogger, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Shards 0 and 1 use different buckets, so they identify at once
+	start := time.Now()
+	for shard := range uint16(2) {
+		if err := s.Wait(ctx, shard); err != nil {
+			t.Fatalf("shard %d failed to identify: %s", shard, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("shards of different buckets waited %s", elapsed)
+	}
+	// Shard 2 waits for the bucket of shard 0
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if err := s.Wait(short, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected shard 2 to wait for its bucket, got %v", err)
+	}
+}
+
+func TestIdentifySchedulerSessionStartLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []IdentifySchedulerOption
+		remaining int
+		err       error
+	}{
+		{name: "not tracked", remaining: -1},
+		{name: "left", opts: []IdentifySchedulerOption{WithSessionStartLimit(1000, 10, time.Hour)}, remaining: 9},
+		{name: "exhausted", opts: []IdentifySchedulerOption{WithSessionStartLimit(1000, 0, time.Hour)}, remaining: 0, err: ErrSessionStartLimit},
+		{name: "reset passed", opts: []IdentifySchedulerOption{WithSessionStartLimit(1000, 0, -time.Second)}, remaining: 999},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewIdentifyScheduler(testLogger, 1, test.opts...)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := s.Wait(ctx, 0); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if remaining, _ := s.Remaining(); remaining != test.remaining {
+				t.Fatalf("expected %d session starts left, got %d", test.remaining, remaining)
+			}
+		})
+	}
+}
+
+func TestIdentifySchedulerCancel(t *testing.T) {
+	s := NewIdentifyScheduler(testLogger, 1, WithSessionStartLimit(1000, 2, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Wait(ctx, 0); err != nil {
+		t.Fatalf("first identify failed: %s", err)
+	}
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if err := s.Wait(short, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	// Cancelled identify gives its session start back
+	if remaining, _ := s.Remaining(); remaining != 1 {
+		t.Fatalf("expected 1 session start left, got %d", remaining)
+	}
+}
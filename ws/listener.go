@@ -0,0 +1,264 @@
+package ws
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultListenBuffer = 64
+	// slowListenerThreshold is how long the listener can stay full before it is reported as slow.
+	slowListenerThreshold = time.Second
+)
+
+// OverflowPolicy decides what happens when the listener buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock waits until the listener receives the event. Other listeners and the connection reader
+	// wait as well, so a listener that stops receiving stalls the whole gateway. Connection events (like Status)
+	// are queued behind the blocked event without stopping the gateway, so it still closes a dead connection.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest removes the oldest buffered event to make room for the new one.
+	OverflowDropOldest
+	// OverflowDisconnect cancels the listener. Its channel is closed.
+	OverflowDisconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", uint8(p))
+	}
+}
+
+type listenOptions struct {
+	buffer   int
+	overflow OverflowPolicy
+	filters  []func(ev any) bool
+}
+
+type ListenOption func(opts *listenOptions)
+
+// WithBuffer sets how many events can wait for the listener before OverflowPolicy is applied.
+func WithBuffer(size int) ListenOption {
+	return func(opts *listenOptions) {
+		opts.buffer = max(size, 0)
+	}
+}
+
+// WithOverflow sets OverflowPolicy of the listener. OverflowBlock is used by default.
+func WithOverflow(policy OverflowPolicy) ListenOption {
+	return func(opts *listenOptions) {
+		opts.overflow = policy
+	}
+}
+
+// WithFilter skips events for which fn returns false. Filters are called before the event is queued, so they have to be fast.
+func WithFilter(fn func(ev any) bool) ListenOption {
+	return func(opts *listenOptions) {
+		opts.filters = append(opts.filters, fn)
+	}
+}
+
+// WithEvents limits dispatch events (opcode 0) to the given names. Other events are not affected.
+func WithEvents(names ...string) ListenOption {
+	return WithFilter(func(ev any) bool {
+		data, ok := ev.(InternalDispatchEvent)
+		return !ok || data.OpCode != 0 || slices.Contains(names, data.Event)
+	})
+}
+
+type listener struct {
+	ch       chan any
+	done     chan struct{}
+	caller   string
+	opts     listenOptions
+	once     sync.Once
+	stopOnce sync.Once
+	dropped  uint64
+	warned   time.Time
+}
+
+func (l *listener) accepts(ev any) bool {
+	for _, filter := range l.opts.filters {
+		if !filter(ev) {
+			return false
+		}
+	}
+	return true
+}
+
+func release(ev any) {
+	if allocator, ok := ev.(InternalEventAllocator); ok {
+		allocator.Dereference()
+	}
+}
+
+func (g *gatewayImpl) Listen(opts ...ListenOption) (events <-chan any, cancel func()) {
+	l := &listener{
+		done: make(chan struct{}),
+		opts: listenOptions{buffer: defaultListenBuffer},
+	}
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+	l.ch = make(chan any, l.opts.buffer)
+	if _, file, line, ok := runtime.Caller(1); ok {
+		l.caller = fmt.Sprintf("%s:%d", file, line)
+	}
+	g.log.Trace().Param("overflow", l.opts.overflow).Param("buffer", l.opts.buffer).Send("Registering new event listener (%s)", l.caller)
+
+	g.mut.Lock()
+	g.listeners = append(g.listeners, l)
+	g.mut.Unlock()
+
+	return l.ch, func() {
+		g.unlisten(l)
+	}
+}
+
+func (l *listener) stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// unlisten removes the listener and closes its channel. Events left in the buffer are released.
+func (g *gatewayImpl) unlisten(l *listener) {
+	// Wakes up sendEvent if it is blocked on this listener
+	l.stop()
+	l.once.Do(func() {
+		g.fanout.Lock()
+		defer g.fanout.Unlock()
+		g.mut.Lock()
+		g.listeners = slices.DeleteFunc(g.listeners, func(v *listener) bool {
+			return v == l
+		})
+		g.mut.Unlock()
+		close(l.ch)
+		for ev := range l.ch {
+			release(ev)
+		}
+		g.log.Trace().Send("Unregistered event listener (%s)", l.caller)
+	})
+}
+
+// sendEvent delivers the event to every listener. Events are queued, so listeners receive them in the same order.
+// Dispatches wait until they are delivered, while connection events (like Status) are delivered in the background
+// if a blocked listener holds the fanout lock, so the gateway can still close a dead connection.
+func (g *gatewayImpl) sendEvent(ev any) {
+	allocator, _ := ev.(InternalEventAllocator)
+	if allocator != nil {
+		// Keeps the event alive until all listeners got it
+		allocator.reference()
+		defer allocator.Dereference()
+	}
+	g.queueMut.Lock()
+	g.queue = append(g.queue, ev)
+	g.queueMut.Unlock()
+	if allocator == nil && !g.fanout.TryLock() {
+		go g.flushEvents(false)
+		return
+	}
+	g.flushEvents(allocator == nil)
+}
+
+// flushEvents delivers queued events. Locked reports whether the fanout lock is held already.
+func (g *gatewayImpl) flushEvents(locked bool) {
+	if !locked {
+		g.fanout.Lock()
+	}
+	defer g.fanout.Unlock()
+	for {
+		g.queueMut.Lock()
+		if len(g.queue) == 0 {
+			g.queueMut.Unlock()
+			return
+		}
+		ev := g.queue[0]
+		g.queue[0] = nil
+		g.queue = g.queue[1:]
+		g.queueMut.Unlock()
+		g.fanOut(ev)
+	}
+}
+
+// fanOut delivers the event to every listener. It must be called with fanout lock held.
+func (g *gatewayImpl) fanOut(ev any) {
+	allocator, _ := ev.(InternalEventAllocator)
+	g.mut.RLock()
+	g.snapshot = append(g.snapshot[:0], g.listeners...)
+	g.mut.RUnlock()
+	for _, l := range g.snapshot {
+		if l.accepts(ev) {
+			if allocator != nil {
+				allocator.reference()
+			}
+			g.deliver(l, ev)
+		}
+	}
+	clear(g.snapshot)
+}
+
+// deliver sends referenced event to the listener, applying its OverflowPolicy. It must be called with fanout lock held.
+func (g *gatewayImpl) deliver(l *listener, ev any) {
+	select {
+	case <-l.done:
+		release(ev)
+		return
+	default:
+	}
+	select {
+	case l.ch <- ev:
+		return
+	default:
+	}
+	switch l.opts.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.ch <- ev:
+				return
+			case old := <-l.ch:
+				release(old)
+				l.dropped++
+				if time.Since(l.warned) >= slowListenerThreshold {
+					l.warned = time.Now()
+					g.log.Warn().Param("dropped", l.dropped).Send("Slow event listener (%s) is losing events", l.caller)
+				}
+			}
+		}
+	case OverflowDisconnect:
+		release(ev)
+		g.log.Warn().Send("Slow event listener (%s) is full, disconnecting it", l.caller)
+		// unlisten waits for fanout lock, so it has to run in the background
+		l.stop()
+		go g.unlisten(l)
+	default:
+		start := time.Now()
+		timer := time.NewTimer(slowListenerThreshold)
+		defer timer.Stop()
+		for {
+			select {
+			case l.ch <- ev:
+				return
+			case <-l.done:
+				release(ev)
+				return
+			case <-timer.C:
+				g.log.Warn().Duration(time.Since(start)).Send("Slow event listener (%s) is blocking the gateway", l.caller)
+				timer.Reset(slowListenerThreshold)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/BOOMfinity/bfcord/metrics"
+)
+
+// heartbeatBuckets cover the usual gateway latency, which is a lot higher than the latency of a handler.
+var heartbeatBuckets = []float64{0.025, 0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 0.75, 1, 2, 5}
+
+// gatewayMetrics holds metrics of a single shard. All of them are labelled with the shard id.
+type gatewayMetrics struct {
+	shard      string
+	events     metrics.Counter
+	filtered   metrics.Counter
+	heartbeat  metrics.Histogram
+	identifies metrics.Counter
+	resumes    metrics.Counter
+	reconnects metrics.Counter
+	received   metrics.Counter
+	sent       metrics.Counter
+}
+
+func (m *gatewayMetrics) event(ev *Event) {
+	m.events.Add(1, m.shard, strconv.FormatUint(uint64(ev.OpCode), 10), ev.Event)
+}
+
+func (m *gatewayMetrics) filteredEvent(ev *Event) {
+	m.filtered.Add(1, m.shard, ev.Event)
+}
+
+func (m *gatewayMetrics) latency(latency time.Duration) {
+	m.heartbeat.Observe(latency.Seconds(), m.shard)
+}
+
+func (m *gatewayMetrics) identified() {
+	m.identifies.Add(1, m.shard)
+}
+
+func (m *gatewayMetrics) resumed() {
+	m.resumes.Add(1, m.shard)
+}
+
+func (m *gatewayMetrics) reconnecting() {
+	m.reconnects.Add(1, m.shard)
+}
+
+func (m *gatewayMetrics) receivedBytes(n int64) {
+	m.received.Add(float64(n), m.shard)
+}
+
+func (m *gatewayMetrics) sentBytes(n int) {
+	m.sent.Add(float64(n), m.shard)
+}
+
+func newGatewayMetrics(reg metrics.Registry, shard uint16) *gatewayMetrics {
+	reg = metrics.Or(reg)
+	return &gatewayMetrics{
+		shard:      strconv.FormatUint(uint64(shard), 10),
+		events:     reg.Counter("bfcord_gateway_events", "Messages received from the gateway.", "shard", "op", "event"),
+		filtered:   reg.Counter("bfcord_gateway_filtered_events", "Dispatches dropped by the event filter without decoding.", "shard", "event"),
+		heartbeat:  reg.Histogram("bfcord_gateway_heartbeat_latency_seconds", "Time between a heartbeat and its ACK.", heartbeatBuckets, "shard"),
+		identifies: reg.Counter("bfcord_gateway_identifies", "New sessions created with Identify.", "shard"),
+		resumes:    reg.Counter("bfcord_gateway_resumes", "Sessions resumed after reconnecting.", "shard"),
+		reconnects: reg.Counter("bfcord_gateway_reconnects", "Scheduled reconnection attempts.", "shard"),
+		received:   reg.Counter("bfcord_gateway_received_bytes", "Bytes received from the gateway (before decompression).", "shard"),
+		sent:       reg.Counter("bfcord_gateway_sent_bytes", "Bytes sent to the gateway.", "shard"),
+	}
+}
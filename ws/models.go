@@ -5,6 +5,8 @@ import (
 	"sync/atomic"
 
 	"github.com/andersfylling/snowflake/v5"
+
+	"github.com/BOOMfinity/bfcord/discord"
 )
 
 type Event struct {
@@ -13,10 +15,17 @@ type Event struct {
 	Seq        uint64          `json:"s"`
 	Event      string          `json:"t"`
 	references atomic.Int64
+	// filtered is set for dispatches rejected by Config.EventFilter, their data is not read
+	filtered bool
 }
 
 func (ev *Event) free() {
+	// Null fields are not touched by the decoder, so pooled events have to be cleared
+	ev.OpCode = 0
 	ev.Data = nil
+	ev.Seq = 0
+	ev.Event = ""
+	ev.filtered = false
 	eventPool.Put(ev)
 }
 
@@ -52,6 +61,53 @@ type Identify struct {
 	LargeThreshold int                `json:"large_threshold,omitempty"`
 	Shard          []uint16           `json:"shard"`
 	Intents        GatewayIntent      `json:"intents"`
+	Presence       *PresenceUpdate    `json:"presence,omitempty"`
+}
+
+// PresenceUpdate is sent with Identify or as opcode 3 to change the bot status and activities.
+//
+// Bots can only set name, state, type and url of the activity.
+type PresenceUpdate struct {
+	// Since is the time when the bot went idle, or nil if it is not idle.
+	Since      *discord.UnixTimestamp `json:"since"`
+	Activities []discord.Activity     `json:"activities"`
+	Status     discord.UserStatus     `json:"status"`
+	AFK        bool                   `json:"afk"`
+}
+
+// presenceActivity is the part of discord.Activity bots can set. Other fields (like unset timestamps) would be sent
+// with zero values otherwise.
+type presenceActivity struct {
+	Name  string               `json:"name"`
+	Type  discord.ActivityType `json:"type"`
+	URL   string               `json:"url,omitempty"`
+	State string               `json:"state,omitempty"`
+}
+
+func (p PresenceUpdate) MarshalJSON() ([]byte, error) {
+	activities := make([]presenceActivity, len(p.Activities))
+	for i, activity := range p.Activities {
+		activities[i] = presenceActivity{
+			Name:  activity.Name,
+			Type:  activity.Type,
+			URL:   activity.URL,
+			State: activity.State,
+		}
+	}
+	return json.Marshal(struct {
+		Since      *discord.UnixTimestamp `json:"since"`
+		Activities []presenceActivity     `json:"activities"`
+		Status     discord.UserStatus     `json:"status"`
+		AFK        bool                   `json:"afk"`
+	}{p.Since, activities, p.Status, p.AFK})
+}
+
+// UpdateVoiceStateParams are sent with opcode 4. Nil ChannelID disconnects from the voice channel.
+type UpdateVoiceStateParams struct {
+	GuildID   snowflake.ID  `json:"guild_id"`
+	ChannelID *snowflake.ID `json:"channel_id"`
+	SelfMute  bool          `json:"self_mute"`
+	SelfDeaf  bool          `json:"self_deaf"`
 }
 
 type IdentifyProperties struct {
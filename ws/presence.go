@@ -0,0 +1,34 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+)
+
+// UpdatePresence sends the presence to Discord and remembers it, so it is restored after reconnecting.
+//
+// If the gateway is not connected, presence will be applied with the next Identify or Resume.
+func (g *gatewayImpl) UpdatePresence(ctx context.Context, presence PresenceUpdate) error {
+	g.mut.Lock()
+	g.presence = &presence
+	g.mut.Unlock()
+	if g.Status() != StatusConnected {
+		g.log.Debug().Send("Gateway is not connected, presence will be sent after connecting")
+		return nil
+	}
+	return g.sendPresence(ctx)
+}
+
+func (g *gatewayImpl) sendPresence(ctx context.Context) error {
+	g.mut.RLock()
+	presence := g.presence
+	g.mut.RUnlock()
+	if presence == nil {
+		return nil
+	}
+	if err := g.send(ctx, priorityNormal, 3, *presence); err != nil {
+		return fmt.Errorf("failed to send presence update: %w", err)
+	}
+	g.log.Trace().Param("status", presence.Status).Send("Presence updated")
+	return nil
+}
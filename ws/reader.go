@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/BOOMfinity/golog/v2"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/encoding/json"
+)
+
+// connReader reads events from a single connection. Every connection has its own reader (and buffers),
+// so the reader of the closed connection cannot interfere with the new one.
+type connReader struct {
+	conn       *websocket.Conn
+	encoding   Encoding
+	inflater   *inflater
+	log        golog.Logger
+	buff       *bytes.Buffer
+	compressed *bytes.Buffer
+	decoded    []byte
+	filter     EventFilter
+	metrics    *gatewayMetrics
+}
+
+func (r *connReader) read() (*Event, error) {
+	r.buff.Reset()
+	for {
+		messageType, reader, err := r.conn.NextReader()
+		if err != nil {
+			var closed *websocket.CloseError
+			if errors.As(err, &closed) {
+				r.log.Warn().
+					Param("code", closed.Code).
+					Param("reason", closed.Text).
+					Send("Connection closed")
+				return nil, fmt.Errorf("connection closed: %w", closeError(err))
+			}
+			return nil, fmt.Errorf("unexpected error: %w", err)
+		}
+		if messageType != websocket.BinaryMessage || r.inflater == nil {
+			n, err := r.buff.ReadFrom(reader)
+			r.metrics.receivedBytes(n)
+			if err != nil {
+				return nil, fmt.Errorf("error reading from connection reader: %w", err)
+			}
+			break
+		}
+		r.compressed.Reset()
+		n, err := r.compressed.ReadFrom(reader)
+		r.metrics.receivedBytes(n)
+		if err != nil {
+			return nil, fmt.Errorf("error reading from connection reader: %w", err)
+		}
+		complete, err := r.inflater.Inflate(r.buff, r.compressed.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing message: %w", err)
+		}
+		if complete {
+			break
+		}
+		r.log.Trace().Param("size", r.compressed.Len()).Send("Compressed message is not complete, waiting for the rest")
+	}
+	payload := r.buff.Bytes()
+	if r.encoding != nil {
+		var err error
+		if r.decoded, err = r.encoding.Decode(r.decoded[:0], payload); err != nil {
+			return nil, fmt.Errorf("error decoding %s payload: %w", r.encoding.Name(), err)
+		}
+		payload = r.decoded
+	}
+	if r.filter != nil {
+		if h, ok := peekHeader(payload); ok && h.op == 0 && !allowEvent(r.filter, h.event) {
+			ev := eventPool.Get()
+			ev.Event = h.event
+			ev.Seq = h.seq
+			ev.filtered = true
+			return ev, nil
+		}
+	}
+	ev := eventPool.Get()
+	if err := json.Unmarshal(payload, ev); err != nil {
+		return nil, fmt.Errorf("error unmarshalling event: %w", err)
+	}
+	{
+		msg := r.log.Trace().
+			Param("op", ev.OpCode)
+		if ev.Event != "" {
+			msg.Param("event", ev.Event)
+		}
+		if len(ev.Data) > 0 {
+			if len(ev.Data) > 1024*1024 {
+				msg.Param("size", fmt.Sprintf("%dMiB", len(ev.Data)/1024/1024))
+			} else if len(ev.Data) > 1024 {
+				msg.Param("size", fmt.Sprintf("%dKiB", len(ev.Data)/1024))
+			} else {
+				msg.Param("size", fmt.Sprintf("%dB", len(ev.Data)))
+			}
+		}
+		msg.Param("seq", ev.Seq).Send("Got message from Discord")
+	}
+	return ev, nil
+}
+
+func (r *connReader) Close() {
+	if r.inflater != nil {
+		r.inflater.Close()
+	}
+}
+
+func newConnReader(conn *websocket.Conn, cfg Config, log golog.Logger, metrics *gatewayMetrics) *connReader {
+	r := &connReader{
+		conn:       conn,
+		encoding:   cfg.Encoding,
+		log:        log,
+		filter:     cfg.EventFilter,
+		metrics:    metrics,
+		buff:       bytes.NewBuffer(make([]byte, 0, 1024*1024)),
+		compressed: bytes.NewBuffer(make([]byte, 0, 64*1024)),
+	}
+	if cfg.Compression != CompressionNone {
+		r.inflater = newInflater(cfg.Compression)
+	}
+	return r
+}
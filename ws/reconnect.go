@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// ReconnectPolicy decides when the gateway reconnects after the connection is lost.
+type ReconnectPolicy interface {
+	// Delay returns how long to wait before given attempt (starting from 1). Returning false stops reconnecting.
+	Delay(attempt uint64) (delay time.Duration, ok bool)
+}
+
+// DefaultReconnectPolicy is used when Config.ReconnectPolicy is nil.
+var DefaultReconnectPolicy = NewBackoffPolicy(time.Second, 2*time.Minute, 0)
+
+type backoffPolicy struct {
+	base     time.Duration
+	max      time.Duration
+	attempts uint64
+}
+
+func (p backoffPolicy) Delay(attempt uint64) (time.Duration, bool) {
+	if p.attempts != 0 && attempt > p.attempts {
+		return 0, false
+	}
+	ceiling := p.base
+	for i := uint64(1); i < attempt && ceiling < p.max; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, p.max)
+	if ceiling <= 0 {
+		return 0, true
+	}
+	return rand.N(ceiling), true
+}
+
+// NewBackoffPolicy creates ReconnectPolicy with exponential backoff and full jitter. Delay is random, between 0
+// and base * 2^(attempt-1) capped at max. After the given number of attempts the gateway gives up (0 means unlimited).
+func NewBackoffPolicy(base, max time.Duration, attempts uint64) ReconnectPolicy {
+	return backoffPolicy{
+		base:     base,
+		max:      max,
+		attempts: attempts,
+	}
+}
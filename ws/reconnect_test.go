@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ReconnectPolicy
+		attempt uint64
+		ceiling time.Duration
+		ok      bool
+	}{
+		{name: "first attempt", policy: NewBackoffPolicy(time.Second, time.Minute, 0), attempt: 1, ceiling: time.Second, ok: true},
+		{name: "doubled", policy: NewBackoffPolicy(time.Second, time.Minute, 0), attempt: 4, ceiling: 8 * time.Second, ok: true},
+		{name: "capped", policy: NewBackoffPolicy(time.Second, time.Minute, 0), attempt: 100, ceiling: time.Minute, ok: true},
+		{name: "last attempt", policy: NewBackoffPolicy(time.Second, time.Minute, 3), attempt: 3, ceiling: 4 * time.Second, ok: true},
+		{name: "gave up", policy: NewBackoffPolicy(time.Second, time.Minute, 3), attempt: 4, ok: false},
+		{name: "no delay", policy: NewBackoffPolicy(0, 0, 0), attempt: 5, ceiling: 0, ok: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for range 100 {
+				delay, ok := test.policy.Delay(test.attempt)
+				if ok != test.ok {
+					t.Fatalf("expected ok %v, got %v", test.ok, ok)
+				}
+				if delay < 0 || delay > test.ceiling {
+					t.Fatalf("expected delay between 0 and %s, got %s", test.ceiling, delay)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package ws
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// RecordedEvent is a single message received from Discord, as saved by Recorder.
+type RecordedEvent struct {
+	OpCode uint            `json:"op"`
+	Event  string          `json:"t,omitempty"`
+	Seq    uint64          `json:"s,omitempty"`
+	Data   json.RawMessage `json:"d"`
+	// Filtered is set for dispatches dropped by Config.EventFilter, which are recorded without their data
+	Filtered   bool      `json:"filtered,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Recorder saves every message received by the gateway, so it can be replayed later with NewReplayGateway.
+// Record is called from the read loop of the gateway, so it should not block.
+type Recorder interface {
+	Record(shard uint16, ev RecordedEvent) error
+	Close() error
+}
+
+// recordFlushInterval is how often recordings are flushed to the disk. Events received in the meantime are lost
+// if the process crashes.
+const recordFlushInterval = time.Second
+
+type recordFile struct {
+	mut   sync.Mutex
+	file  *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	dirty bool
+}
+
+func (r *recordFile) write(data []byte) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.dirty = true
+	_, err := r.gz.Write(data)
+	return err
+}
+
+func (r *recordFile) flush() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	r.dirty = false
+	if err := r.gz.Flush(); err != nil {
+		return err
+	}
+	return r.buf.Flush()
+}
+
+func (r *recordFile) close() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return errors.Join(r.gz.Close(), r.buf.Flush(), r.file.Close())
+}
+
+type fileRecorder struct {
+	dir string
+	// run names files of this recorder, so every run is recorded to new files
+	run    string
+	files  map[uint16]*recordFile
+	mut    sync.Mutex
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func (f *fileRecorder) open(shard uint16) (*recordFile, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.closed {
+		return nil, ErrRecorderClosed
+	}
+	if file, ok := f.files[shard]; ok {
+		return file, nil
+	}
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	name := filepath.Join(f.dir, fmt.Sprintf("shard-%d-%s.jsonl.gz", shard, f.run))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording file: %w", err)
+	}
+	buf := bufio.NewWriterSize(file, 64*1024)
+	rf := &recordFile{file: file, buf: buf, gz: gzip.NewWriter(buf)}
+	f.files[shard] = rf
+	return rf, nil
+}
+
+func (f *fileRecorder) Record(shard uint16, ev RecordedEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recorded event: %w", err)
+	}
+	file, err := f.open(shard)
+	if err != nil {
+		return err
+	}
+	if err = file.write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write recorded event: %w", err)
+	}
+	return nil
+}
+
+// flusher flushes recordings periodically, so they survive a crash (which is usually the thing to debug)
+// without writing to the disk for every event.
+func (f *fileRecorder) flusher() {
+	defer close(f.done)
+	ticker := time.NewTicker(recordFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.mut.Lock()
+			files := make([]*recordFile, 0, len(f.files))
+			for _, file := range f.files {
+				files = append(files, file)
+			}
+			f.mut.Unlock()
+			for _, file := range files {
+				// Write errors are reported by Close, as the writer keeps them
+				_ = file.flush()
+			}
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+func (f *fileRecorder) Close() error {
+	f.mut.Lock()
+	if f.closed {
+		f.mut.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.stop)
+	f.mut.Unlock()
+	<-f.done
+	var errs []error
+	for shard, file := range f.files {
+		errs = append(errs, file.close())
+		delete(f.files, shard)
+	}
+	return errors.Join(errs...)
+}
+
+// NewFileRecorder creates Recorder writing events of every shard to a separate gzip compressed JSONL file
+// (shard-<id>-<start time>.jsonl.gz) inside dir, so every run is recorded to new files. Recordings are flushed
+// every second. A file of a crashed run ends abruptly, but NewReplayGateway replays it up to the last flush.
+func NewFileRecorder(dir string) Recorder {
+	f := &fileRecorder{
+		dir:   dir,
+		run:   time.Now().UTC().Format("20060102T150405.000000000"),
+		files: make(map[uint16]*recordFile),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go f.flusher()
+	return f
+}
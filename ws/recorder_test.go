@@ -0,0 +1,175 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// replayFile replays the recording and returns sequences of replayed dispatches.
+func replayFile(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	gtw := NewReplayGateway(Config{Logger: testLogger.Module("replay")}, bytes.NewReader(data), 0)
+	events, cancel := gtw.Listen(WithBuffer(1024))
+	defer cancel()
+	if err := gtw.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var seqs []uint64
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			switch data := ev.(type) {
+			case InternalDispatchEvent:
+				seqs = append(seqs, data.Seq)
+				data.Dereference()
+			case InternalReplayFinishedEvent:
+				if data.Err != nil {
+					t.Fatalf("replay failed: %s", data.Err)
+				}
+				return seqs
+			}
+		case <-timeout:
+			t.Fatal("replay did not finish")
+		}
+	}
+}
+
+func record(t *testing.T, r Recorder, shard uint16, seqs ...uint64) {
+	t.Helper()
+	for _, seq := range seqs {
+		err := r.Record(shard, RecordedEvent{Event: "MESSAGE_CREATE", Seq: seq, Data: []byte(fmt.Sprintf(`{"id":"%d"}`, seq)), ReceivedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func recordings(t *testing.T, dir string, shard uint16) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("shard-%d-*.jsonl.gz", shard)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestFileRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r := NewFileRecorder(dir)
+	record(t, r, 0, 1, 2, 3)
+	record(t, r, 1, 1)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Record(0, RecordedEvent{}); err != ErrRecorderClosed {
+		t.Fatalf("expected %v, got %v", ErrRecorderClosed, err)
+	}
+	// The next run is recorded to new files
+	r = NewFileRecorder(dir)
+	record(t, r, 0, 1)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := recordings(t, dir, 0)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 recordings of shard 0, got %d", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs := replayFile(t, data); fmt.Sprint(seqs) != "[1 2 3]" {
+		t.Fatalf("expected [1 2 3], got %v", seqs)
+	}
+}
+
+func TestFileRecorderCrash(t *testing.T) {
+	dir := t.TempDir()
+	r := NewFileRecorder(dir)
+	defer r.Close()
+	record(t, r, 0, 1, 2)
+	// Recording is read before it is closed, like after a crash
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		files := recordings(t, dir, 0)
+		if len(files) != 1 {
+			t.Fatalf("expected 1 recording, got %d", len(files))
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seqs := replayFile(t, data); fmt.Sprint(seqs) == "[1 2]" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("recording was not flushed")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestReplayDelay(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name     string
+		speed    float64
+		previous time.Time
+		next     time.Time
+		expected time.Duration
+	}{
+		{name: "first event", speed: 1, next: start, expected: 0},
+		{name: "real time", speed: 1, previous: start, next: start.Add(time.Second), expected: time.Second},
+		{name: "faster", speed: 10, previous: start, next: start.Add(time.Second), expected: 100 * time.Millisecond},
+		{name: "no wait", speed: 0, previous: start, next: start.Add(time.Second), expected: 0},
+		{name: "next run", speed: 1, previous: start, next: start.Add(24 * time.Hour), expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := &replayGateway{speed: test.speed}
+			if wait := g.delay(test.previous, test.next); wait != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, wait)
+			}
+		})
+	}
+}
+
+func TestReplayNextRun(t *testing.T) {
+	start := time.Now()
+	var data bytes.Buffer
+	for i, rec := range []RecordedEvent{
+		{Event: "READY", Seq: 1, ReceivedAt: start},
+		{Event: "MESSAGE_CREATE", Seq: 2, ReceivedAt: start},
+		// Next run starts in 30 seconds, which is not waited for
+		{Event: "READY", Seq: 1, ReceivedAt: start.Add(30 * time.Second)},
+	} {
+		fmt.Fprintf(&data, `{"op":0,"t":%q,"s":%d,"d":{"n":%d},"received_at":%q}`+"\n", rec.Event, rec.Seq, i, rec.ReceivedAt.Format(time.RFC3339Nano))
+	}
+	gtw := NewReplayGateway(Config{Logger: testLogger.Module("replay")}, &data, 1)
+	events, cancel := gtw.Listen(WithBuffer(16))
+	defer cancel()
+	if err := gtw.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if finished, ok := ev.(InternalReplayFinishedEvent); ok {
+				if finished.Events != 3 {
+					t.Fatalf("expected 3 events, got %d", finished.Events)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("gap between runs was replayed")
+		}
+	}
+}
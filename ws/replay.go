@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/discord"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// replayGateway emits dispatch events from a recording instead of connecting to Discord.
+type replayGateway struct {
+	*gatewayImpl
+
+	src     io.Reader
+	speed   float64
+	started bool
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func (g *replayGateway) Connect(_ context.Context) error {
+	g.mut.Lock()
+	if g.started {
+		g.mut.Unlock()
+		return ErrReplayStarted
+	}
+	g.started = true
+	g.mut.Unlock()
+	g.log.Info().Param("speed", g.speed).Send("Replaying recorded events")
+	g.changeStatus(StatusConnecting)
+	g.changeStatus(StatusConnected)
+	go g.replay()
+	return nil
+}
+
+func (g *replayGateway) replay() {
+	count, err := g.play()
+	if err != nil {
+		g.log.Error().Throw(err)
+	}
+	g.log.Info().Param("events", count).Send("Replay finished")
+	g.sendEvent(InternalConnectionClosed{Code: websocket.CloseNormalClosure, Err: err})
+	g.changeStatus(StatusDisconnected)
+	g.sendEvent(InternalReplayFinishedEvent{Events: count, Err: err})
+}
+
+func (g *replayGateway) play() (count int, err error) {
+	buffered := bufio.NewReaderSize(g.src, 64*1024)
+	lines := buffered
+	if magic, _ := buffered.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open compressed recording: %w", err)
+		}
+		defer gz.Close()
+		lines = bufio.NewReaderSize(gz, 64*1024)
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	var (
+		previous time.Time
+		seq      uint64
+	)
+	for line := 1; ; line++ {
+		data, err := lines.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 && !errors.Is(err, io.ErrUnexpectedEOF) {
+			var rec RecordedEvent
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return count, fmt.Errorf("invalid recorded event at line %d: %w", line, err)
+			}
+			// Sequence starts again in the next run (or after re-identifying), which is not waited for
+			if rec.Seq > 0 && rec.Seq < seq {
+				previous = time.Time{}
+			}
+			if wait := g.delay(previous, rec.ReceivedAt); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-timer.C:
+				case <-g.stop:
+					return count, nil
+				}
+			}
+			previous = rec.ReceivedAt
+			if rec.Seq > 0 {
+				seq = rec.Seq
+			}
+			// Only dispatches are replayed, other opcodes belong to the connection, which does not exist here.
+			// Filtered dispatches were recorded without their data.
+			if rec.OpCode == 0 && !rec.Filtered && allowEvent(g.cfg.EventFilter, rec.Event) {
+				ev := eventPool.Get()
+				ev.OpCode = rec.OpCode
+				ev.Event = rec.Event
+				ev.Seq = rec.Seq
+				ev.Data = rec.Data
+				g.seq.Store(rec.Seq)
+				g.sendEvent((InternalDispatchEvent)(ev))
+				count++
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// Recording of a crashed run ends after the last flush
+			g.log.Warn().Param("line", line).Send("Recording ends abruptly, skipping its last (incomplete) event")
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read recording: %w", err)
+		}
+		select {
+		case <-g.stop:
+			return count, nil
+		default:
+		}
+	}
+}
+
+// maxReplayGap is the longest recorded gap between events waited for. Longer gaps are gaps between runs recorded
+// to the same file (Discord sends heartbeat ACKs at least every minute).
+const maxReplayGap = time.Minute
+
+func (g *replayGateway) delay(previous, next time.Time) time.Duration {
+	if g.speed <= 0 || previous.IsZero() {
+		return 0
+	}
+	gap := next.Sub(previous)
+	if gap > maxReplayGap {
+		return 0
+	}
+	return time.Duration(float64(gap) / g.speed)
+}
+
+func (g *replayGateway) Disconnect() {
+	g.once.Do(func() {
+		close(g.stop)
+	})
+}
+
+func (g *replayGateway) Close() error {
+	g.Disconnect()
+	return nil
+}
+
+func (g *replayGateway) Send(_ context.Context, _ uint, _ any) error {
+	return ErrReplayReadOnly
+}
+
+func (g *replayGateway) FetchMembers(_ context.Context, _ RequestGuildMembersParams) ([]discord.MemberWithUser, []discord.Presence, error) {
+	return nil, nil, ErrReplayReadOnly
+}
+
+func (g *replayGateway) UpdatePresence(_ context.Context, _ PresenceUpdate) error {
+	return ErrReplayReadOnly
+}
+
+func (g *replayGateway) UpdateVoiceState(_ context.Context, _ UpdateVoiceStateParams) error {
+	return ErrReplayReadOnly
+}
+
+// NewReplayGateway creates Gateway emitting dispatch events read from src, which is a (optionally gzip compressed)
+// recording made by Recorder. Connect starts the replay and InternalReplayFinishedEvent is sent at the end.
+//
+// Speed multiplies the recorded pace: 1 replays in real time, 10 is ten times faster and 0 is as fast as possible.
+// Gaps longer than a minute (like between runs recorded to one file) are not waited for.
+func NewReplayGateway(cfg Config, src io.Reader, speed float64) Gateway {
+	return &replayGateway{
+		gatewayImpl: NewGateway(cfg).(*gatewayImpl),
+		src:         src,
+		speed:       speed,
+		stop:        make(chan struct{}),
+	}
+}
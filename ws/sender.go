@@ -0,0 +1,235 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/BOOMfinity/golog/v2"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/encoding/json"
+)
+
+const (
+	sendRateLimit    = 120
+	sendRateWindow   = 60 * time.Second
+	sendRateReserved = 5
+	maxQueuedSends   = 1024
+)
+
+type sendPriority uint8
+
+const (
+	priorityNormal sendPriority = iota
+	priorityHandshake
+	priorityHeartbeat
+	priorityCount
+)
+
+type sendRequest struct {
+	op       uint
+	payload  sendEvent[any]
+	priority sendPriority
+	done     chan error
+}
+
+// sender is the only writer of a single connection. Requests are written in priority order
+// and non-heartbeat requests leave a few slots of the rate limit for heartbeats.
+type sender struct {
+	conn     *websocket.Conn
+	encoding Encoding
+	log      golog.Logger
+	metrics  *gatewayMetrics
+	queues   [priorityCount][]*sendRequest
+	queued   int
+	sent     []time.Time
+	wake     chan struct{}
+	closed   chan struct{}
+	mut      sync.Mutex
+}
+
+func (s *sender) write(v any) error {
+	messageType := websocket.BinaryMessage
+	var (
+		data []byte
+		err  error
+	)
+	if s.encoding == nil {
+		messageType = websocket.TextMessage
+		if data, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("error marshalling payload: %w", err)
+		}
+	} else if data, err = s.encoding.Encode(v); err != nil {
+		return fmt.Errorf("error encoding %s payload: %w", s.encoding.Name(), err)
+	}
+	if err = s.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	s.metrics.sentBytes(len(data))
+	return nil
+}
+
+// delay returns how long request with given priority has to wait for the rate limit.
+func (s *sender) delay(priority sendPriority, now time.Time) time.Duration {
+	for len(s.sent) > 0 && now.Sub(s.sent[0]) >= sendRateWindow {
+		s.sent = s.sent[1:]
+	}
+	limit := sendRateLimit - sendRateReserved
+	if priority == priorityHeartbeat {
+		limit = sendRateLimit
+	}
+	if len(s.sent) < limit {
+		return 0
+	}
+	return s.sent[len(s.sent)-limit].Add(sendRateWindow).Sub(now)
+}
+
+func (s *sender) next() (req *sendRequest, wait time.Duration) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for priority := priorityCount - 1; ; priority-- {
+		if len(s.queues[priority]) > 0 {
+			req = s.queues[priority][0]
+			break
+		}
+		if priority == 0 {
+			return nil, 0
+		}
+	}
+	if wait = s.delay(req.priority, time.Now()); wait > 0 {
+		return req, wait
+	}
+	s.queues[req.priority] = s.queues[req.priority][1:]
+	s.queued--
+	return req, 0
+}
+
+func (s *sender) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	for {
+		req, wait := s.next()
+		if req == nil {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.closed:
+				return
+			}
+		}
+		if wait > 0 {
+			s.log.Debug().Param("op", req.op).Duration(wait).Send("Gateway send rate limit reached, waiting")
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				if !timer.Stop() {
+					<-timer.C
+				}
+			case <-s.closed:
+				return
+			}
+			continue
+		}
+		err := s.write(req.payload)
+		s.mut.Lock()
+		s.sent = append(s.sent, time.Now())
+		s.mut.Unlock()
+		if err != nil {
+			err = fmt.Errorf("failed to write message to Discord: %w", err)
+		}
+		req.done <- err
+	}
+}
+
+func (s *sender) remove(req *sendRequest) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	index := slices.Index(s.queues[req.priority], req)
+	if index == -1 {
+		return false
+	}
+	s.queues[req.priority] = slices.Delete(s.queues[req.priority], index, index+1)
+	s.queued--
+	return true
+}
+
+// Send queues the request and waits until it is written.
+func (s *sender) Send(ctx context.Context, priority sendPriority, op uint, data any) error {
+	req := &sendRequest{
+		op:       op,
+		payload:  sendEvent[any]{OpCode: op, Data: data},
+		priority: priority,
+		done:     make(chan error, 1),
+	}
+	s.mut.Lock()
+	select {
+	case <-s.closed:
+		s.mut.Unlock()
+		return ErrSendDropped
+	default:
+	}
+	if s.queued >= maxQueuedSends {
+		s.mut.Unlock()
+		s.log.Warn().Param("op", op).Send("Send queue is full, dropping the message")
+		return ErrSendQueueFull
+	}
+	s.queues[priority] = append(s.queues[priority], req)
+	s.queued++
+	s.mut.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		if s.remove(req) {
+			s.log.Warn().Param("op", op).Send("Message expired before it could be sent")
+			return fmt.Errorf("%w: %w", ErrSendExpired, ctx.Err())
+		}
+		// Request is being written right now
+		return <-req.done
+	}
+}
+
+// Close stops the writer and fails all queued requests with ErrSendDropped.
+func (s *sender) Close() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	close(s.closed)
+	for i, queue := range s.queues {
+		for _, req := range queue {
+			req.done <- ErrSendDropped
+		}
+		if len(queue) > 0 {
+			s.log.Debug().Param("count", len(queue)).Send("Dropped queued messages")
+		}
+		s.queues[i] = nil
+	}
+	s.queued = 0
+}
+
+func newSender(conn *websocket.Conn, encoding Encoding, log golog.Logger, metrics *gatewayMetrics) *sender {
+	s := &sender{
+		conn:     conn,
+		encoding: encoding,
+		log:      log,
+		metrics:  metrics,
+		wake:     make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
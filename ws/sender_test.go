@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSenderDelay(t *testing.T) {
+	now := time.Now()
+	// sentAt returns n sends spread over the last second
+	sentAt := func(n int, ago time.Duration) []time.Time {
+		sent := make([]time.Time, n)
+		for i := range sent {
+			sent[i] = now.Add(-ago)
+		}
+		return sent
+	}
+	tests := []struct {
+		name     string
+		sent     []time.Time
+		priority sendPriority
+		expected time.Duration
+	}{
+		{name: "empty", priority: priorityNormal, expected: 0},
+		{name: "below limit", sent: sentAt(sendRateLimit-sendRateReserved-1, time.Second), priority: priorityNormal, expected: 0},
+		{name: "reserved for heartbeats", sent: sentAt(sendRateLimit-sendRateReserved, time.Second), priority: priorityNormal, expected: sendRateWindow - time.Second},
+		{name: "heartbeat uses reserved", sent: sentAt(sendRateLimit-sendRateReserved, time.Second), priority: priorityHeartbeat, expected: 0},
+		{name: "heartbeat limit", sent: sentAt(sendRateLimit, time.Second), priority: priorityHeartbeat, expected: sendRateWindow - time.Second},
+		{name: "window passed", sent: sentAt(sendRateLimit, sendRateWindow), priority: priorityNormal, expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &sender{sent: test.sent}
+			if delay := s.delay(test.priority, now); delay != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, delay)
+			}
+		})
+	}
+}
+
+func TestSenderNext(t *testing.T) {
+	s := &sender{}
+	normal := &sendRequest{op: 3, priority: priorityNormal}
+	handshake := &sendRequest{op: 2, priority: priorityHandshake}
+	heartbeat := &sendRequest{op: 1, priority: priorityHeartbeat}
+	for _, req := range []*sendRequest{normal, handshake, heartbeat} {
+		s.queues[req.priority] = append(s.queues[req.priority], req)
+		s.queued++
+	}
+	for _, expected := range []*sendRequest{heartbeat, handshake, normal} {
+		req, wait := s.next()
+		if req != expected || wait != 0 {
+			t.Fatalf("expected op %d without waiting, got op %d and %s", expected.op, req.op, wait)
+		}
+	}
+	if req, _ := s.next(); req != nil {
+		t.Fatalf("expected empty queue, got op %d", req.op)
+	}
+
+	// Rate limited request stays in the queue
+	s.sent = make([]time.Time, sendRateLimit)
+	for i := range s.sent {
+		s.sent[i] = time.Now()
+	}
+	s.queues[priorityNormal] = append(s.queues[priorityNormal], normal)
+	s.queued++
+	if req, wait := s.next(); req != normal || wait <= 0 {
+		t.Fatalf("expected rate limited request, got %v and %s", req, wait)
+	}
+	if s.queued != 1 {
+		t.Fatalf("expected 1 queued request, got %d", s.queued)
+	}
+}
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// SessionResumeWindow is the maximum age of the stored session state that is still used to resume.
+// Older sessions are most likely invalidated by Discord already, so the shard identifies instead.
+const SessionResumeWindow = 5 * time.Minute
+
+// SessionState contains everything needed to resume the gateway session.
+type SessionState struct {
+	SessionID  string    `json:"session_id"`
+	ResumeURL  string    `json:"resume_url"`
+	Seq        uint64    `json:"seq"`
+	ShardCount uint16    `json:"shard_count"`
+	SavedAt    time.Time `json:"saved_at"`
+}
+
+// SessionStore persists gateway sessions, so they can be resumed after the process restarts.
+type SessionStore interface {
+	// Load returns the saved session of the shard. It should return false if nothing was saved.
+	Load(shard uint16) (state SessionState, ok bool, err error)
+	Save(shard uint16, state SessionState) error
+	Delete(shard uint16) error
+}
+
+type fileSessionStore struct {
+	dir string
+}
+
+func (f fileSessionStore) path(shard uint16) string {
+	return filepath.Join(f.dir, fmt.Sprintf("shard-%d.json", shard))
+}
+
+func (f fileSessionStore) Load(shard uint16) (state SessionState, ok bool, err error) {
+	data, err := os.ReadFile(f.path(shard))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, false, nil
+		}
+		return state, false, fmt.Errorf("failed to read session file: %w", err)
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return state, false, fmt.Errorf("failed to unmarshal session file: %w", err)
+	}
+	return state, true, nil
+}
+
+func (f fileSessionStore) Save(shard uint16, state SessionState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err = os.MkdirAll(f.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	// Written to the temporary file first, so a crash cannot leave a half-written session
+	tmp := f.path(shard) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err = os.Rename(tmp, f.path(shard)); err != nil {
+		return fmt.Errorf("failed to replace session file: %w", err)
+	}
+	return nil
+}
+
+func (f fileSessionStore) Delete(shard uint16) error {
+	if err := os.Remove(f.path(shard)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session file: %w", err)
+	}
+	return nil
+}
+
+// NewFileSessionStore creates SessionStore that keeps every shard session in a separate JSON file inside dir.
+func NewFileSessionStore(dir string) SessionStore {
+	return fileSessionStore{dir: dir}
+}
@@ -3,6 +3,8 @@ package ws
 import (
 	"github.com/BOOMfinity/go-utils/rate"
 	"github.com/BOOMfinity/golog/v2"
+
+	"github.com/BOOMfinity/bfcord/metrics"
 )
 
 type Status string
@@ -10,6 +12,7 @@ type Status string
 const (
 	StatusConnected    Status = "connected"
 	StatusConnecting   Status = "connecting"
+	StatusResuming     Status = "resuming"
 	StatusReconnecting Status = "reconnecting"
 	StatusDisconnected Status = "disconnected"
 )
@@ -19,8 +22,24 @@ type Config struct {
 	ID            uint16
 	ShardCount    uint16
 	Logger        golog.Logger
-	Compression   bool
+	Compression   Compression
+	Encoding      Encoding
 	Token         string
 	Intents       GatewayIntent
 	GlobalLimiter *rate.Limiter
+	// IdentifyLimiter is used instead of GlobalLimiter if set.
+	IdentifyLimiter IdentifyLimiter
+	// Presence is sent with Identify. It is replaced by the last presence passed to Gateway.UpdatePresence.
+	Presence *PresenceUpdate
+	// SessionStore is used to save the session on Gateway.Close and resume it on the next Connect.
+	SessionStore SessionStore
+	// ReconnectPolicy decides when to reconnect after the connection is lost. DefaultReconnectPolicy is used if nil.
+	ReconnectPolicy ReconnectPolicy
+	// Recorder saves every received message. It is not closed by the gateway.
+	Recorder Recorder
+	// EventFilter drops unwanted dispatches before they are decoded. Dropped dispatches are recorded without their data,
+	// so they are not replayed.
+	EventFilter EventFilter
+	// Metrics receives gateway metrics. They are not collected if nil.
+	Metrics metrics.Registry
 }
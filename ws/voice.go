@@ -0,0 +1,19 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+)
+
+// UpdateVoiceState sends opcode 4 to join, move between or leave voice channels.
+//
+// Discord answers with VOICE_STATE_UPDATE and (when joining) VOICE_SERVER_UPDATE dispatches.
+func (g *gatewayImpl) UpdateVoiceState(ctx context.Context, params UpdateVoiceStateParams) error {
+	if g.Status() != StatusConnected {
+		return ErrGatewayNotConnected
+	}
+	if err := g.send(ctx, priorityNormal, 4, params); err != nil {
+		return fmt.Errorf("failed to send voice state update: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package wstest
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+type dispatch struct {
+	seq   uint64
+	event string
+	data  json.RawMessage
+}
+
+// session outlives connections, so it can be resumed with missed events.
+type session struct {
+	id      string
+	shard   uint16
+	count   uint16
+	seq     uint64
+	history []dispatch
+	conn    *conn
+}
+
+type frame struct {
+	OpCode uint   `json:"op"`
+	Data   any    `json:"d"`
+	Seq    uint64 `json:"s,omitempty"`
+	Event  string `json:"t,omitempty"`
+}
+
+type conn struct {
+	server  *Server
+	ws      *websocket.Conn
+	mut     sync.Mutex
+	session *session
+}
+
+func (c *conn) write(op uint, event string, seq uint64, data any) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.ws.WriteJSON(frame{OpCode: op, Data: data, Seq: seq, Event: event})
+}
+
+func (c *conn) close(code int, reason string) {
+	_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	_ = c.ws.Close()
+}
+
+func (c *conn) shard() int {
+	c.server.mut.Lock()
+	defer c.server.mut.Unlock()
+	if c.session == nil {
+		return -1
+	}
+	return int(c.session.shard)
+}
+
+func (c *conn) serve() {
+	defer c.detach()
+	hello := ws.HelloOp{HeartbeatInterval: uint(c.server.heartbeat.Milliseconds())}
+	if err := c.write(10, "", 0, hello); err != nil {
+		return
+	}
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var payload struct {
+			OpCode uint            `json:"op"`
+			Data   json.RawMessage `json:"d"`
+		}
+		if err = json.Unmarshal(data, &payload); err != nil {
+			c.close(4002, "decode error")
+			return
+		}
+		ok := c.handle(payload.OpCode, payload.Data)
+		c.server.record(Payload{
+			Shard:      c.shard(),
+			OpCode:     payload.OpCode,
+			Data:       payload.Data,
+			ReceivedAt: time.Now(),
+		})
+		if !ok {
+			return
+		}
+	}
+}
+
+func (c *conn) detach() {
+	c.server.mut.Lock()
+	if c.session != nil && c.session.conn == c {
+		c.session.conn = nil
+	}
+	c.server.mut.Unlock()
+	_ = c.ws.Close()
+}
+
+// handle answers the payload. It returns false if the connection was closed.
+func (c *conn) handle(op uint, data json.RawMessage) bool {
+	switch op {
+	case 1:
+		c.server.mut.Lock()
+		noACK := c.server.noACK
+		c.server.mut.Unlock()
+		return noACK || c.write(11, "", 0, nil) == nil
+	case 2:
+		return c.identify(data)
+	case 6:
+		return c.resume(data)
+	case 3, 4, 8:
+		if c.shard() == -1 {
+			c.close(4003, "not authenticated")
+			return false
+		}
+		return true
+	default:
+		c.close(4001, "unknown opcode")
+		return false
+	}
+}
+
+func (c *conn) identify(data json.RawMessage) bool {
+	s := c.server
+	var identify ws.Identify
+	if err := json.Unmarshal(data, &identify); err != nil {
+		c.close(4002, "decode error")
+		return false
+	}
+	if c.shard() != -1 {
+		c.close(4005, "already authenticated")
+		return false
+	}
+	if s.token != "" && identify.Token != s.token {
+		c.close(4004, "authentication failed")
+		return false
+	}
+	if len(identify.Shard) == 0 {
+		identify.Shard = []uint16{0, 1}
+	}
+	s.mut.Lock()
+	count := s.shardCount
+	s.mut.Unlock()
+	if len(identify.Shard) != 2 || identify.Shard[1] != count || identify.Shard[0] >= identify.Shard[1] {
+		c.close(4010, "invalid shard")
+		return false
+	}
+	if identify.Intents&s.disallowed != 0 {
+		c.close(4014, "disallowed intents")
+		return false
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	sess := &session{
+		id:    fmt.Sprintf("%016x", rand.Uint64()),
+		shard: identify.Shard[0],
+		count: identify.Shard[1],
+		conn:  c,
+	}
+	s.sessions[sess.id] = sess
+	s.shards[sess.shard] = sess
+	c.session = sess
+
+	guilds := s.shardGuilds(sess.shard)
+	ready := ws.ReadyEvent{
+		Version:          10,
+		User:             s.user,
+		Guilds:           make([]ws.UnavailableGuild, 0, len(guilds)),
+		SessionID:        sess.id,
+		Shard:            [2]uint16{sess.shard, s.shardCount},
+		ResumeGatewayURL: s.URL(),
+	}
+	for _, guild := range guilds {
+		ready.Guilds = append(ready.Guilds, ws.UnavailableGuild{ID: guild.ID, Unavailable: true})
+	}
+	if err := s.dispatch(sess, "READY", ready); err != nil {
+		return false
+	}
+	for _, guild := range guilds {
+		if err := s.dispatch(sess, "GUILD_CREATE", guild); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *conn) resume(data json.RawMessage) bool {
+	s := c.server
+	var resume struct {
+		Token     string `json:"token"`
+		SessionID string `json:"session_id"`
+		Seq       uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &resume); err != nil {
+		c.close(4002, "decode error")
+		return false
+	}
+	if c.shard() != -1 {
+		c.close(4005, "already authenticated")
+		return false
+	}
+	if s.token != "" && resume.Token != s.token {
+		c.close(4004, "authentication failed")
+		return false
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	sess, ok := s.sessions[resume.SessionID]
+	if !ok {
+		return c.write(9, "", 0, false) == nil
+	}
+	sess.conn = c
+	c.session = sess
+	for _, missed := range sess.history {
+		if missed.seq <= resume.Seq {
+			continue
+		}
+		if err := c.write(0, missed.event, missed.seq, missed.data); err != nil {
+			return false
+		}
+	}
+	return s.dispatch(sess, "RESUMED", nil) == nil
+}
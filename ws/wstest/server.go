@@ -0,0 +1,344 @@
+// Package wstest provides a local gateway server for testing ws.Gateway and client.Session without Discord.
+//
+// Server speaks JSON encoded gateway protocol without transport compression. It validates Identify and Resume,
+// answers heartbeats, sends READY with GUILD_CREATE of configured guilds and replays missed events on resume.
+// Tests can inject dispatches, force close codes and wait for payloads sent by the client.
+package wstest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andersfylling/snowflake/v5"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/encoding/json"
+
+	"github.com/BOOMfinity/bfcord/api"
+	"github.com/BOOMfinity/bfcord/discord"
+	"github.com/BOOMfinity/bfcord/ws"
+)
+
+var (
+	ErrNoSession    = errors.New("shard has no session")
+	ErrNotConnected = errors.New("shard is not connected")
+)
+
+// Payload is a message received from the client.
+type Payload struct {
+	// Shard is -1 if the connection has not identified (or resumed) yet.
+	Shard      int
+	OpCode     uint
+	Data       json.RawMessage
+	ReceivedAt time.Time
+}
+
+// Op returns predicate for Server.WaitFor matching payloads with given opcode.
+func Op(op uint) func(p Payload) bool {
+	return func(p Payload) bool {
+		return p.OpCode == op
+	}
+}
+
+type ServerOption func(s *Server)
+
+// WithToken sets the token expected in Identify and Resume. Any token is accepted by default.
+func WithToken(token string) ServerOption {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// WithShardCount sets the shard count expected in Identify and returned from GatewayInfo. Default is 1.
+func WithShardCount(count uint16) ServerOption {
+	return func(s *Server) {
+		s.shardCount = count
+	}
+}
+
+// WithHeartbeatInterval sets the interval sent in Hello. Default is 41.25 seconds.
+func WithHeartbeatInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.heartbeat = interval
+	}
+}
+
+// WithUser sets the bot user sent in READY.
+func WithUser(user discord.User) ServerOption {
+	return func(s *Server) {
+		s.user = user
+	}
+}
+
+// WithGuilds adds guilds sent as unavailable in READY and then as GUILD_CREATE to the shard they belong to.
+func WithGuilds(guilds ...ws.GuildCreateEvent) ServerOption {
+	return func(s *Server) {
+		s.guilds = append(s.guilds, guilds...)
+	}
+}
+
+// WithDisallowedIntents makes the server close connections identifying with any of given intents with code 4014.
+func WithDisallowedIntents(intents ws.GatewayIntent) ServerOption {
+	return func(s *Server) {
+		s.disallowed = intents
+	}
+}
+
+// Server is a fake Discord gateway. Use URL as ws.Config URL or pass Server to client.Creator GatewayInfo.
+type Server struct {
+	http       *httptest.Server
+	token      string
+	shardCount uint16
+	heartbeat  time.Duration
+	user       discord.User
+	guilds     []ws.GuildCreateEvent
+	disallowed ws.GatewayIntent
+
+	mut      sync.Mutex
+	sessions map[string]*session
+	shards   map[uint16]*session
+	received []Payload
+	cursor   int
+	notify   chan struct{}
+	noACK    bool
+}
+
+// URL returns websocket address of the server.
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http") + "/"
+}
+
+// GatewayInfo returns the server URL and configured shard count, like GET /gateway/bot.
+func (s *Server) GatewayInfo() (api.BotGateway, error) {
+	s.mut.Lock()
+	count := s.shardCount
+	s.mut.Unlock()
+	return api.BotGateway{
+		URL:    s.URL(),
+		Shards: count,
+		Limit: api.SessionStartLimit{
+			Total:          1000,
+			Remaining:      1000,
+			ResetAfter:     int((24 * time.Hour).Milliseconds()),
+			MaxConcurrency: 1,
+		},
+	}, nil
+}
+
+// Close closes all connections and stops the server.
+func (s *Server) Close() {
+	s.mut.Lock()
+	for _, sess := range s.shards {
+		if sess.conn != nil {
+			sess.conn.close(websocket.CloseGoingAway, "")
+		}
+	}
+	s.mut.Unlock()
+	s.http.Close()
+}
+
+// SetShardCount changes the shard count required by Identify and returned by GatewayInfo, as Discord does when the bot grows.
+// Already connected shards are not affected.
+func (s *Server) SetShardCount(count uint16) {
+	s.mut.Lock()
+	s.shardCount = count
+	s.mut.Unlock()
+}
+
+// SetHeartbeatACK enables or disables answering heartbeats. Disabled ACKs make the connection look like a zombie.
+func (s *Server) SetHeartbeatACK(enabled bool) {
+	s.mut.Lock()
+	s.noACK = !enabled
+	s.mut.Unlock()
+}
+
+// Dispatch sends the event to the shard. Event is stored in the session and replayed on resume if the shard is not connected.
+func (s *Server) Dispatch(shard uint16, event string, data any) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	sess, ok := s.shards[shard]
+	if !ok {
+		return ErrNoSession
+	}
+	return s.dispatch(sess, event, data)
+}
+
+// DispatchGuild sends the event of the guild to every session handling the guild, like Discord does while shards
+// of the old and new shard count are connected at the same time. It returns ErrNoSession if no session handles the guild.
+// Write errors are ignored, as connections of replaced shards can be closed at any time.
+func (s *Server) DispatchGuild(guild snowflake.ID, event string, data any) error {
+	if _, err := json.Marshal(data); err != nil {
+		return err
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	sent := false
+	for _, sess := range s.sessions {
+		if shardOf(guild, sess.count) != sess.shard {
+			continue
+		}
+		_ = s.dispatch(sess, event, data)
+		sent = true
+	}
+	if !sent {
+		return ErrNoSession
+	}
+	return nil
+}
+
+// CloseShard closes the connection of the shard with given close code. Events dispatched after that are replayed
+// on resume.
+func (s *Server) CloseShard(shard uint16, code int, reason string) error {
+	c, err := s.conn(shard)
+	if err != nil {
+		return err
+	}
+	c.close(code, reason)
+	c.detach()
+	return nil
+}
+
+// RequestReconnect sends opcode 7 to the shard.
+func (s *Server) RequestReconnect(shard uint16) error {
+	c, err := s.conn(shard)
+	if err != nil {
+		return err
+	}
+	return c.write(7, "", 0, nil)
+}
+
+// InvalidateSession sends opcode 9 to the shard. Not resumable session is removed from the server.
+func (s *Server) InvalidateSession(shard uint16, resumable bool) error {
+	s.mut.Lock()
+	sess, ok := s.shards[shard]
+	if !ok {
+		s.mut.Unlock()
+		return ErrNoSession
+	}
+	if !resumable {
+		delete(s.sessions, sess.id)
+		delete(s.shards, shard)
+	}
+	c := sess.conn
+	s.mut.Unlock()
+	if c == nil {
+		return ErrNotConnected
+	}
+	return c.write(9, "", 0, resumable)
+}
+
+// Received returns all payloads received from clients.
+func (s *Server) Received() []Payload {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]Payload(nil), s.received...)
+}
+
+// WaitFor returns the first received payload matching fn. Payloads are consumed in order: every call starts
+// after the payload returned by the previous one, so a script can wait for consecutive Identify or Resume payloads.
+func (s *Server) WaitFor(ctx context.Context, fn func(p Payload) bool) (Payload, error) {
+	for {
+		s.mut.Lock()
+		for i := s.cursor; i < len(s.received); i++ {
+			if fn(s.received[i]) {
+				s.cursor = i + 1
+				p := s.received[i]
+				s.mut.Unlock()
+				return p, nil
+			}
+		}
+		notify := s.notify
+		s.mut.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return Payload{}, ctx.Err()
+		}
+	}
+}
+
+func (s *Server) conn(shard uint16) (*conn, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	sess, ok := s.shards[shard]
+	if !ok {
+		return nil, ErrNoSession
+	}
+	if sess.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return sess.conn, nil
+}
+
+func (s *Server) record(p Payload) {
+	s.mut.Lock()
+	s.received = append(s.received, p)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.mut.Unlock()
+}
+
+// dispatch stores the event in the session and sends it if the shard is connected. It must be called with mut held.
+func (s *Server) dispatch(sess *session, event string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	sess.seq++
+	sess.history = append(sess.history, dispatch{seq: sess.seq, event: event, data: raw})
+	if sess.conn == nil {
+		return nil
+	}
+	return sess.conn.write(0, event, sess.seq, json.RawMessage(raw))
+}
+
+func (s *Server) shardGuilds(shard uint16) (guilds []ws.GuildCreateEvent) {
+	for _, guild := range s.guilds {
+		if shardOf(guild.ID, s.shardCount) == shard {
+			guilds = append(guilds, guild)
+		}
+	}
+	return guilds
+}
+
+func shardOf(id snowflake.ID, count uint16) uint16 {
+	return uint16((uint64(id) >> 22) % uint64(count))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if encoding := query.Get("encoding"); encoding != "" && encoding != "json" {
+		http.Error(w, "only json encoding is supported", http.StatusBadRequest)
+		return
+	}
+	if query.Get("compress") != "" {
+		http.Error(w, "transport compression is not supported", http.StatusBadRequest)
+		return
+	}
+	wsConn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{server: s, ws: wsConn}
+	c.serve()
+}
+
+// NewServer starts a new gateway server on a random local port.
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		shardCount: 1,
+		heartbeat:  41250 * time.Millisecond,
+		sessions:   make(map[string]*session),
+		shards:     make(map[uint16]*session),
+		notify:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.http = httptest.NewServer(s)
+	return s
+}